@@ -0,0 +1,69 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package balancer implements the load-balancing policies a Linker can use
+// to pick one endpoint out of the multiple addresses a discovery source
+// maintains for a service.
+package balancer
+
+import "errors"
+
+// ErrNoEndpoint is returned when Pick is called with no endpoints.
+var ErrNoEndpoint = errors.New("balancer: no available endpoint")
+
+// Endpoint is one candidate address, along with the weight its discovery
+// source assigned it (defaults to 1 when the source has no notion of weight).
+type Endpoint struct {
+	Addr   string
+	Weight int
+}
+
+// HealthChecker lets a Balancer skip addresses that a circuit breaker (or
+// any other health-tracking plugin) currently considers unhealthy.
+type HealthChecker interface {
+	IsHealthy(addr string) bool
+}
+
+// InFlightCounter reports the number of in-flight requests to addr, used by
+// the power-of-two-choices policy to prefer the less loaded endpoint.
+type InFlightCounter interface {
+	InFlight(addr string) int64
+}
+
+// Balancer selects one endpoint out of many according to some policy.
+// hashKey is only consulted by hash-based policies; other policies ignore it.
+type Balancer interface {
+	Pick(hashKey string, endpoints []Endpoint) (string, error)
+}
+
+// filterHealthy returns the endpoints considered healthy by checker, or the
+// original slice unchanged if checker is nil or nothing passes the filter
+// (so a Balancer never fails outright just because every known address is
+// currently marked unhealthy; Pull/Push will fail on the call itself and the
+// circuit breaker will keep the state accurate for next time).
+func filterHealthy(checker HealthChecker, endpoints []Endpoint) []Endpoint {
+	if checker == nil {
+		return endpoints
+	}
+	healthy := make([]Endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		if checker.IsHealthy(e.Addr) {
+			healthy = append(healthy, e)
+		}
+	}
+	if len(healthy) == 0 {
+		return endpoints
+	}
+	return healthy
+}
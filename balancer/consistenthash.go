@@ -0,0 +1,109 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultVirtualNodes = 160
+
+// NewConsistentHash creates a Balancer that maps hashKey onto a hash ring
+// built from endpoints (with virtualNodes replicas per endpoint to smooth
+// the distribution), so the same hashKey keeps resolving to the same
+// endpoint across calls as long as the endpoint set is stable.
+func NewConsistentHash(checker HealthChecker) Balancer {
+	return &consistentHash{checker: checker, virtualNodes: defaultVirtualNodes}
+}
+
+type ringEntry struct {
+	hash uint32
+	addr string
+}
+
+type consistentHash struct {
+	checker      HealthChecker
+	virtualNodes int
+
+	mu      sync.Mutex
+	ringSig string // signature of the endpoint set ring was built from
+	ring    []ringEntry
+}
+
+func (b *consistentHash) Pick(hashKey string, endpoints []Endpoint) (string, error) {
+	endpoints = filterHealthy(b.checker, endpoints)
+	if len(endpoints) == 0 {
+		return "", ErrNoEndpoint
+	}
+	if hashKey == "" {
+		// No hash key supplied: fall back to the first endpoint so the
+		// policy is still deterministic rather than silently random.
+		return endpoints[0].Addr, nil
+	}
+
+	ring := b.ringFor(endpoints)
+	target := crc32.ChecksumIEEE([]byte(hashKey))
+	idx := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= target })
+	if idx == len(ring) {
+		idx = 0
+	}
+	return ring[idx].addr, nil
+}
+
+// ringFor returns the sorted hash ring for endpoints, rebuilding it only
+// when the endpoint set has actually changed since the last call - Pick
+// runs on every RPC dispatch, so re-sorting len(endpoints)*virtualNodes
+// entries on each one would make the balancer the bottleneck.
+func (b *consistentHash) ringFor(endpoints []Endpoint) []ringEntry {
+	sig := ringSignature(endpoints)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if sig == b.ringSig {
+		return b.ring
+	}
+
+	ring := make([]ringEntry, 0, len(endpoints)*b.virtualNodes)
+	for _, e := range endpoints {
+		for i := 0; i < b.virtualNodes; i++ {
+			ring = append(ring, ringEntry{
+				hash: crc32.ChecksumIEEE([]byte(e.Addr + "#" + strconv.Itoa(i))),
+				addr: e.Addr,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	b.ringSig = sig
+	b.ring = ring
+	return ring
+}
+
+// ringSignature identifies an endpoint set by its addresses in order, which
+// is all ringFor needs to detect a change; Watcher.Endpoints appends new
+// addresses at a stable position, so this is cheap and collision-free in
+// practice (addresses never contain the separator).
+func ringSignature(endpoints []Endpoint) string {
+	var sb strings.Builder
+	for _, e := range endpoints {
+		sb.WriteString(e.Addr)
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import "math/rand"
+
+// NewP2C creates a power-of-two-choices Balancer: it picks two endpoints at
+// random and returns whichever has fewer in-flight requests, which spreads
+// load nearly as evenly as full least-connections at a fraction of the cost.
+// If counter is nil, it degenerates to a uniformly random pick between the two.
+func NewP2C(checker HealthChecker, counter InFlightCounter) Balancer {
+	return &p2c{checker: checker, counter: counter}
+}
+
+type p2c struct {
+	checker HealthChecker
+	counter InFlightCounter
+}
+
+func (b *p2c) Pick(_ string, endpoints []Endpoint) (string, error) {
+	endpoints = filterHealthy(b.checker, endpoints)
+	switch len(endpoints) {
+	case 0:
+		return "", ErrNoEndpoint
+	case 1:
+		return endpoints[0].Addr, nil
+	}
+	i, j := rand.Intn(len(endpoints)), rand.Intn(len(endpoints)-1)
+	if j >= i {
+		j++
+	}
+	a, c := endpoints[i], endpoints[j]
+	if b.counter == nil {
+		return a.Addr, nil
+	}
+	if b.counter.InFlight(a.Addr) <= b.counter.InFlight(c.Addr) {
+		return a.Addr, nil
+	}
+	return c.Addr, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"math/rand"
+)
+
+// NewRandom creates a Balancer that picks a uniformly random endpoint.
+func NewRandom(checker HealthChecker) Balancer {
+	return &random{checker: checker}
+}
+
+type random struct {
+	checker HealthChecker
+}
+
+func (b *random) Pick(_ string, endpoints []Endpoint) (string, error) {
+	endpoints = filterHealthy(b.checker, endpoints)
+	if len(endpoints) == 0 {
+		return "", ErrNoEndpoint
+	}
+	return endpoints[rand.Intn(len(endpoints))].Addr, nil
+}
+
+// NewWeightedRandom creates a Balancer that picks an endpoint with
+// probability proportional to its Weight (endpoints with Weight<=0 are
+// treated as weight 1).
+func NewWeightedRandom(checker HealthChecker) Balancer {
+	return &weightedRandom{checker: checker}
+}
+
+type weightedRandom struct {
+	checker HealthChecker
+}
+
+func (b *weightedRandom) Pick(_ string, endpoints []Endpoint) (string, error) {
+	endpoints = filterHealthy(b.checker, endpoints)
+	if len(endpoints) == 0 {
+		return "", ErrNoEndpoint
+	}
+	total := 0
+	for _, e := range endpoints {
+		total += weightOf(e)
+	}
+	r := rand.Intn(total)
+	for _, e := range endpoints {
+		r -= weightOf(e)
+		if r < 0 {
+			return e.Addr, nil
+		}
+	}
+	return endpoints[len(endpoints)-1].Addr, nil
+}
+
+func weightOf(e Endpoint) int {
+	if e.Weight <= 0 {
+		return 1
+	}
+	return e.Weight
+}
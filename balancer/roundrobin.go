@@ -0,0 +1,36 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import "sync/atomic"
+
+// NewRoundRobin creates a Balancer that cycles through endpoints in order.
+func NewRoundRobin(checker HealthChecker) Balancer {
+	return &roundRobin{checker: checker}
+}
+
+type roundRobin struct {
+	checker HealthChecker
+	next    uint64
+}
+
+func (b *roundRobin) Pick(_ string, endpoints []Endpoint) (string, error) {
+	endpoints = filterHealthy(b.checker, endpoints)
+	if len(endpoints) == 0 {
+		return "", ErrNoEndpoint
+	}
+	idx := atomic.AddUint64(&b.next, 1) - 1
+	return endpoints[idx%uint64(len(endpoints))].Addr, nil
+}
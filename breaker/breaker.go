@@ -0,0 +1,185 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package breaker implements a per-address circuit breaker with the
+// classic Closed/Open/Half-Open state machine, so a Client (or Server,
+// for overload shedding) can stop hammering a remote address that is
+// already failing instead of waiting out its own call timeout every time.
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is one of the three circuit breaker states.
+type State int32
+
+const (
+	// Closed allows all requests through while counting rolling-window failures.
+	Closed State = iota
+	// Open fails every request fast without touching the remote address.
+	Open
+	// HalfOpen allows a small quota of trial requests through to test recovery.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Config controls trip/reset thresholds. All breakers created by the same
+// Breaker share one Config.
+type Config struct {
+	// WindowSize is the span of the rolling failure-ratio window.
+	WindowSize time.Duration `yaml:"window_size"        ini:"window_size"        comment:"Rolling window size over which the failure ratio is computed; ns,µs,ms,s,m,h"`
+	// BucketInterval is the width of each bucket in the rolling window ring.
+	BucketInterval time.Duration `yaml:"bucket_interval"    ini:"bucket_interval"    comment:"Width of each rolling-window bucket; ns,µs,ms,s,m,h"`
+	// MinRequests is the minimum number of requests in the window before the
+	// failure ratio is evaluated, so one unlucky early failure can't trip it.
+	MinRequests int64 `yaml:"min_requests"       ini:"min_requests"       comment:"Minimum requests in the window before a trip can occur"`
+	// FailureRatio is the fraction (0,1] of failed requests in the window that trips the breaker.
+	FailureRatio float64 `yaml:"failure_ratio"      ini:"failure_ratio"      comment:"Failure ratio over the window that trips the breaker, e.g. 0.5"`
+	// OpenTimeout is how long the breaker stays Open before probing Half-Open.
+	OpenTimeout time.Duration `yaml:"open_timeout"       ini:"open_timeout"       comment:"Minimum time an address stays Open before a Half-Open probe; ns,µs,ms,s,m,h"`
+	// MaxOpenTimeout caps the exponential backoff applied to repeated trips.
+	MaxOpenTimeout time.Duration `yaml:"max_open_timeout"   ini:"max_open_timeout"   comment:"Upper bound for the Open-state backoff; ns,µs,ms,s,m,h"`
+	// HalfOpenMaxRequests bounds how many trial requests are allowed while Half-Open.
+	HalfOpenMaxRequests int64 `yaml:"half_open_max_requests" ini:"half_open_max_requests" comment:"Maximum concurrent trial requests allowed while Half-Open"`
+}
+
+func (c *Config) check() {
+	if c.WindowSize <= 0 {
+		c.WindowSize = 10 * time.Second
+	}
+	if c.BucketInterval <= 0 {
+		c.BucketInterval = 100 * time.Millisecond
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.FailureRatio <= 0 {
+		c.FailureRatio = 0.5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = time.Second
+	}
+	if c.MaxOpenTimeout <= 0 {
+		c.MaxOpenTimeout = 30 * time.Second
+	}
+	if c.HalfOpenMaxRequests <= 0 {
+		c.HalfOpenMaxRequests = 5
+	}
+}
+
+func (c *Config) buckets() int {
+	n := int(c.WindowSize / c.BucketInterval)
+	if n <= 0 {
+		n = 1
+	}
+	return n
+}
+
+// Listener is notified of state transitions, for logging/metrics plugins.
+type Listener func(addr string, from, to State)
+
+// Breaker tracks an independent circuit per remote address.
+type Breaker struct {
+	cfg       Config
+	listeners []Listener
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// New creates a Breaker with cfg, defaulting any unset fields.
+func New(cfg Config) *Breaker {
+	cfg.check()
+	return &Breaker{
+		cfg:      cfg,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// OnStateChange registers a listener invoked on every state transition,
+// across all addresses tracked by this Breaker.
+func (b *Breaker) OnStateChange(l Listener) {
+	b.mu.Lock()
+	b.listeners = append(b.listeners, l)
+	b.mu.Unlock()
+}
+
+func (b *Breaker) circuitFor(addr string) *circuit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[addr]
+	if !ok {
+		c = newCircuit(addr, &b.cfg, b.notify)
+		b.circuits[addr] = c
+	}
+	return c
+}
+
+func (b *Breaker) notify(addr string, from, to State) {
+	b.mu.Lock()
+	listeners := make([]Listener, len(b.listeners))
+	copy(listeners, b.listeners)
+	b.mu.Unlock()
+	for _, l := range listeners {
+		l(addr, from, to)
+	}
+}
+
+// Allow reports whether a request to addr may proceed right now. Every
+// Allow call that returns true MUST be paired with exactly one of Success
+// or Failure once the request completes.
+func (b *Breaker) Allow(addr string) bool {
+	return b.circuitFor(addr).allow()
+}
+
+// Success records a successful request to addr.
+func (b *Breaker) Success(addr string) {
+	b.circuitFor(addr).recordSuccess()
+}
+
+// Failure records a failed request to addr.
+func (b *Breaker) Failure(addr string) {
+	b.circuitFor(addr).recordFailure()
+}
+
+// State reports the current state of addr's circuit (Closed if never seen).
+func (b *Breaker) State(addr string) State {
+	b.mu.Lock()
+	c, ok := b.circuits[addr]
+	b.mu.Unlock()
+	if !ok {
+		return Closed
+	}
+	return c.currentState()
+}
+
+// IsHealthy implements balancer.HealthChecker so a Balancer can skip
+// addresses whose circuit is currently Open.
+func (b *Breaker) IsHealthy(addr string) bool {
+	return b.State(addr) != Open
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breaker
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// bucket holds the success/failure counts for one BucketInterval slot.
+type bucket struct {
+	stamp    int64 // unix nanos of the slot this bucket currently represents
+	success  int64
+	failures int64
+}
+
+// window is a lock-free ring of buckets, one per BucketInterval, summed on
+// read. Writes only ever touch the current slot via atomic ops, so the hot
+// path (recordSuccess/recordFailure) never blocks.
+type window struct {
+	interval time.Duration
+	buckets  []bucket
+}
+
+func newWindow(cfg *Config) *window {
+	return &window{
+		interval: cfg.BucketInterval,
+		buckets:  make([]bucket, cfg.buckets()),
+	}
+}
+
+func (w *window) slot(now time.Time) *bucket {
+	idx := (now.UnixNano() / w.interval.Nanoseconds()) % int64(len(w.buckets))
+	b := &w.buckets[idx]
+	stamp := now.UnixNano() / w.interval.Nanoseconds()
+	if atomic.LoadInt64(&b.stamp) != stamp {
+		// A new slot; if another goroutine races us here they'll both
+		// reset, which only loses a few counts right at the boundary.
+		atomic.StoreInt64(&b.success, 0)
+		atomic.StoreInt64(&b.failures, 0)
+		atomic.StoreInt64(&b.stamp, stamp)
+	}
+	return b
+}
+
+func (w *window) recordSuccess(now time.Time) {
+	atomic.AddInt64(&w.slot(now).success, 1)
+}
+
+func (w *window) recordFailure(now time.Time) {
+	atomic.AddInt64(&w.slot(now).failures, 1)
+}
+
+// totals sums every bucket still inside the rolling window as of now.
+func (w *window) totals(now time.Time) (success, failures int64) {
+	cutoff := now.Add(-time.Duration(len(w.buckets)) * w.interval).UnixNano() / w.interval.Nanoseconds()
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		stamp := atomic.LoadInt64(&b.stamp)
+		if stamp < cutoff {
+			continue
+		}
+		success += atomic.LoadInt64(&b.success)
+		failures += atomic.LoadInt64(&b.failures)
+	}
+	return
+}
+
+// circuit is the per-address state machine.
+type circuit struct {
+	addr   string
+	cfg    *Config
+	notify func(addr string, from, to State)
+
+	win *window
+
+	mu            sync.Mutex
+	state         State
+	openedAt      time.Time
+	openTimeout   time.Duration
+	halfOpenInUse int64
+}
+
+func newCircuit(addr string, cfg *Config, notify func(string, State, State)) *circuit {
+	return &circuit{
+		addr:        addr,
+		cfg:         cfg,
+		notify:      notify,
+		win:         newWindow(cfg),
+		state:       Closed,
+		openTimeout: cfg.OpenTimeout,
+	}
+}
+
+// currentState reports c's current state under lock; named apart from the
+// state field since Go doesn't allow a method and field to share a name.
+func (c *circuit) currentState() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *circuit) allow() bool {
+	now := time.Now()
+	c.mu.Lock()
+	switch c.state {
+	case Closed:
+		c.mu.Unlock()
+		return true
+	case Open:
+		if now.Sub(c.openedAt) < c.openTimeout {
+			c.mu.Unlock()
+			return false
+		}
+		c.setState(HalfOpen)
+		c.halfOpenInUse = 1
+		c.mu.Unlock()
+		return true
+	case HalfOpen:
+		if c.halfOpenInUse >= c.cfg.HalfOpenMaxRequests {
+			c.mu.Unlock()
+			return false
+		}
+		c.halfOpenInUse++
+		c.mu.Unlock()
+		return true
+	default:
+		c.mu.Unlock()
+		return true
+	}
+}
+
+func (c *circuit) recordSuccess() {
+	now := time.Now()
+	c.win.recordSuccess(now)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case HalfOpen:
+		if c.halfOpenInUse > 0 {
+			c.halfOpenInUse--
+		}
+		c.setState(Closed)
+		c.openTimeout = c.cfg.OpenTimeout
+	case Closed:
+		// nothing to do; trip check happens on failures.
+	}
+}
+
+func (c *circuit) recordFailure() {
+	now := time.Now()
+	c.win.recordFailure(now)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case HalfOpen:
+		if c.halfOpenInUse > 0 {
+			c.halfOpenInUse--
+		}
+		c.trip(now, true)
+	case Closed:
+		success, failures := c.win.totals(now)
+		total := success + failures
+		if total >= c.cfg.MinRequests {
+			ratio := float64(failures) / float64(total)
+			if ratio >= c.cfg.FailureRatio {
+				c.trip(now, false)
+			}
+		}
+	}
+}
+
+// trip opens the circuit. backoff doubles the next Open-state timeout, up
+// to MaxOpenTimeout, so a repeatedly-flapping address backs off
+// exponentially; it's true exactly when this trip follows a failed
+// half-open probe, meaning the address is still bad after already being
+// given one timeout. A fresh Closed->Open trip always starts at the base
+// OpenTimeout.
+func (c *circuit) trip(now time.Time, backoff bool) {
+	c.openedAt = now
+	if backoff {
+		c.openTimeout *= 2
+		if c.openTimeout > c.cfg.MaxOpenTimeout {
+			c.openTimeout = c.cfg.MaxOpenTimeout
+		}
+	}
+	c.setState(Open)
+}
+
+// setState must be called with c.mu held.
+func (c *circuit) setState(to State) {
+	from := c.state
+	if from == to {
+		return
+	}
+	c.state = to
+	if c.notify != nil {
+		go c.notify(c.addr, from, to)
+	}
+}
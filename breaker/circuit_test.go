@@ -0,0 +1,158 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		WindowSize:          50 * time.Millisecond,
+		BucketInterval:      10 * time.Millisecond,
+		MinRequests:         4,
+		FailureRatio:        0.5,
+		OpenTimeout:         20 * time.Millisecond,
+		MaxOpenTimeout:      200 * time.Millisecond,
+		HalfOpenMaxRequests: 1,
+	}
+}
+
+func TestBreakerTripsAndRecovers(t *testing.T) {
+	b := New(testConfig())
+	const addr = "10.0.0.1:8080"
+
+	if !b.Allow(addr) {
+		t.Fatal("a fresh address must start Closed and allow requests")
+	}
+	if b.State(addr) != Closed {
+		t.Fatalf("state = %v, want Closed", b.State(addr))
+	}
+
+	for i := 0; i < int(testConfig().MinRequests); i++ {
+		if !b.Allow(addr) {
+			t.Fatalf("request %d: Closed breaker must allow all requests", i)
+		}
+		b.Failure(addr)
+	}
+	if b.State(addr) != Open {
+		t.Fatalf("state after tripping = %v, want Open", b.State(addr))
+	}
+	if b.Allow(addr) {
+		t.Fatal("Open breaker must not allow requests before OpenTimeout elapses")
+	}
+	if b.IsHealthy(addr) {
+		t.Fatal("IsHealthy must be false while Open")
+	}
+
+	time.Sleep(testConfig().OpenTimeout + 10*time.Millisecond)
+	if !b.Allow(addr) {
+		t.Fatal("Open breaker must allow a trial request once OpenTimeout elapses")
+	}
+	if b.State(addr) != HalfOpen {
+		t.Fatalf("state after OpenTimeout = %v, want HalfOpen", b.State(addr))
+	}
+
+	b.Success(addr)
+	if b.State(addr) != Closed {
+		t.Fatalf("state after a successful probe = %v, want Closed", b.State(addr))
+	}
+	if !b.IsHealthy(addr) {
+		t.Fatal("IsHealthy must be true once Closed again")
+	}
+}
+
+func TestBreakerBackoffOnRepeatedHalfOpenFailure(t *testing.T) {
+	cfg := testConfig()
+	b := New(cfg)
+	const addr = "10.0.0.2:8080"
+
+	for i := 0; i < int(cfg.MinRequests); i++ {
+		b.Allow(addr)
+		b.Failure(addr)
+	}
+	if b.State(addr) != Open {
+		t.Fatalf("state = %v, want Open", b.State(addr))
+	}
+
+	time.Sleep(cfg.OpenTimeout + 10*time.Millisecond)
+	if !b.Allow(addr) {
+		t.Fatal("expected a half-open trial request to be allowed")
+	}
+	b.Failure(addr)
+	if b.State(addr) != Open {
+		t.Fatalf("state after a failed probe = %v, want Open", b.State(addr))
+	}
+
+	// The failed probe must double the Open timeout: the breaker should
+	// still be rejecting shortly after the base OpenTimeout has elapsed.
+	time.Sleep(cfg.OpenTimeout + 10*time.Millisecond)
+	if b.Allow(addr) {
+		t.Fatal("a repeat offender must back off past the base OpenTimeout")
+	}
+
+	time.Sleep(2 * cfg.OpenTimeout)
+	if !b.Allow(addr) {
+		t.Fatal("expected the breaker to allow a trial once the doubled timeout elapses")
+	}
+}
+
+func TestBreakerOnStateChange(t *testing.T) {
+	cfg := testConfig()
+	b := New(cfg)
+	const addr = "10.0.0.3:8080"
+
+	transitions := make(chan State, 8)
+	b.OnStateChange(func(gotAddr string, from, to State) {
+		if gotAddr != addr {
+			t.Errorf("listener addr = %q, want %q", gotAddr, addr)
+		}
+		transitions <- to
+	})
+
+	for i := 0; i < int(cfg.MinRequests); i++ {
+		b.Allow(addr)
+		b.Failure(addr)
+	}
+
+	select {
+	case to := <-transitions:
+		if to != Open {
+			t.Fatalf("transition = %v, want Open", to)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the Open transition to be reported")
+	}
+}
+
+func TestBreakerIndependentPerAddress(t *testing.T) {
+	cfg := testConfig()
+	b := New(cfg)
+
+	for i := 0; i < int(cfg.MinRequests); i++ {
+		b.Allow("a")
+		b.Failure("a")
+	}
+	if b.State("a") != Open {
+		t.Fatalf("state of a = %v, want Open", b.State("a"))
+	}
+	if b.State("b") != Closed {
+		t.Fatalf("state of untouched address b = %v, want Closed", b.State("b"))
+	}
+	if !b.Allow("b") {
+		t.Fatal("b's circuit must be unaffected by a's trip")
+	}
+}
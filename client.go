@@ -15,7 +15,10 @@
 package ants
 
 import (
+	"crypto/tls"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/henrylee2cn/cfgo"
@@ -24,6 +27,14 @@ import (
 	"github.com/henrylee2cn/teleport/socket"
 	heartbeat "github.com/henrylee2cn/tp-ext/plugin-heartbeat"
 	cliSession "github.com/henrylee2cn/tp-ext/sundry-cliSession"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/henrylee2cn/ants/balancer"
+	"github.com/henrylee2cn/ants/breaker"
+	"github.com/henrylee2cn/ants/discovery"
+	"github.com/henrylee2cn/ants/metrics"
+	"github.com/henrylee2cn/ants/quic"
+	"github.com/henrylee2cn/ants/ratelimit"
 )
 
 // CliConfig client config
@@ -31,20 +42,56 @@ import (
 //  yaml tag is used for github.com/henrylee2cn/cfgo
 //  ini tag is used for github.com/henrylee2cn/ini
 type CliConfig struct {
-	TlsCertFile         string        `yaml:"tls_cert_file"          ini:"tls_cert_file"          comment:"TLS certificate file path"`
-	TlsKeyFile          string        `yaml:"tls_key_file"           ini:"tls_key_file"           comment:"TLS key file path"`
-	DefaultReadTimeout  time.Duration `yaml:"default_read_timeout"   ini:"default_read_timeout"   comment:"Default maximum duration for reading; ns,µs,ms,s,m,h"`
-	DefaultWriteTimeout time.Duration `yaml:"default_write_timeout"  ini:"default_write_timeout"  comment:"Default maximum duration for writing; ns,µs,ms,s,m,h"`
-	DefaultDialTimeout  time.Duration `yaml:"default_dial_timeout"   ini:"default_dial_timeout"   comment:"Default maximum duration for dialing; for client role; ns,µs,ms,s,m,h"`
-	RedialTimes         int32         `yaml:"redial_times"           ini:"redial_times"           comment:"The maximum times of attempts to redial, after the connection has been unexpectedly broken; for client role"`
-	SlowCometDuration   time.Duration `yaml:"slow_comet_duration"    ini:"slow_comet_duration"    comment:"Slow operation alarm threshold; ns,µs,ms,s ..."`
-	DefaultBodyCodec    string        `yaml:"default_body_codec"     ini:"default_body_codec"     comment:"Default body codec type id"`
-	PrintBody           bool          `yaml:"print_body"             ini:"print_body"             comment:"Is print body or not"`
-	CountTime           bool          `yaml:"count_time"             ini:"count_time"             comment:"Is count cost time or not"`
-	Network             string        `yaml:"network"                ini:"network"                comment:"Network; tcp, tcp4, tcp6, unix or unixpacket"`
-	Heartbeat           time.Duration `yaml:"heartbeat"              ini:"heartbeat"              comment:"When the heartbeat interval is greater than 0, heartbeat is enabled; ns,µs,ms,s,m,h"`
-	SessMaxQuota        int           `yaml:"sess_max_quota"         ini:"sess_max_quota"         comment:"The maximum number of sessions in the connection pool"`
-	SessMaxIdleDuration time.Duration `yaml:"sess_max_idle_duration" ini:"sess_max_idle_duration" comment:"The maximum time period for the idle session in the connection pool; ns,µs,ms,s,m,h"`
+	TlsCertFile         string             `yaml:"tls_cert_file"          ini:"tls_cert_file"          comment:"TLS certificate file path"`
+	TlsKeyFile          string             `yaml:"tls_key_file"           ini:"tls_key_file"           comment:"TLS key file path"`
+	DefaultReadTimeout  time.Duration      `yaml:"default_read_timeout"   ini:"default_read_timeout"   comment:"Default maximum duration for reading; ns,µs,ms,s,m,h"`
+	DefaultWriteTimeout time.Duration      `yaml:"default_write_timeout"  ini:"default_write_timeout"  comment:"Default maximum duration for writing; ns,µs,ms,s,m,h"`
+	Forwarding          ForwardingTimeouts `yaml:"forwarding"             ini:"forwarding"             comment:"Fine-grained dial/handshake/idle timeouts for the forwarding path"`
+	RedialTimes         int32              `yaml:"redial_times"           ini:"redial_times"           comment:"The maximum times of attempts to redial, after the connection has been unexpectedly broken; for client role"`
+	SlowCometDuration   time.Duration      `yaml:"slow_comet_duration"    ini:"slow_comet_duration"    comment:"Slow operation alarm threshold; ns,µs,ms,s ..."`
+	DefaultBodyCodec    string             `yaml:"default_body_codec"     ini:"default_body_codec"     comment:"Default body codec type id"`
+	PrintBody           bool               `yaml:"print_body"             ini:"print_body"             comment:"Is print body or not"`
+	CountTime           bool               `yaml:"count_time"             ini:"count_time"             comment:"Is count cost time or not"`
+	Network             string             `yaml:"network"                ini:"network"                comment:"Network; tcp, tcp4, tcp6, unix, unixpacket, quic, quic4 or quic6"`
+	Heartbeat           time.Duration      `yaml:"heartbeat"              ini:"heartbeat"              comment:"When the heartbeat interval is greater than 0, heartbeat is enabled; ns,µs,ms,s,m,h"`
+	SessMaxQuota        int                `yaml:"sess_max_quota"         ini:"sess_max_quota"         comment:"The maximum number of sessions in the connection pool"`
+	SessMaxIdleDuration time.Duration      `yaml:"sess_max_idle_duration" ini:"sess_max_idle_duration" comment:"The maximum time period for the idle session in the connection pool; ns,µs,ms,s,m,h"`
+	Discovery           discovery.Config   `yaml:"discovery"              ini:"discovery"              comment:"Dynamic service discovery backend; leave endpoints empty to use a static linker"`
+	BalancerPolicy      string             `yaml:"balancer_policy"        ini:"balancer_policy"        comment:"Policy used to pick among discovered endpoints: round_robin (default), random, weighted_random, p2c or consistent_hash"`
+	Breaker             *breaker.Config    `yaml:"breaker"                ini:"breaker"                comment:"Per-endpoint circuit breaker; leave nil to disable"`
+	Metrics             *metrics.Config    `yaml:"metrics"                ini:"metrics"                comment:"Embedded Prometheus admin endpoint (/metrics, /debug/sessions); leave nil to disable"`
+	Quic                quic.Config        `yaml:"quic"                   ini:"quic"                   comment:"QUIC transport tuning; only consulted when Network is quic, quic4 or quic6"`
+	Bandwidth           *ratelimit.Config  `yaml:"bandwidth"              ini:"bandwidth"              comment:"Token-bucket bandwidth limiting; leave nil to disable"`
+}
+
+// isQUICNetwork reports whether network names one of ants' own QUIC
+// schemes rather than one tp.PeerConfig recognizes natively.
+func isQUICNetwork(network string) bool {
+	switch network {
+	case "quic", "quic4", "quic6":
+		return true
+	default:
+		return false
+	}
+}
+
+// newBalancer builds the balancer.Balancer named by policy, wiring checker
+// (the Client's breaker, or nil when none is configured) in as its
+// HealthChecker so discovered addresses the breaker currently considers
+// Open are skipped. An empty or unrecognized policy defaults to round-robin.
+func newBalancer(policy string, checker balancer.HealthChecker) balancer.Balancer {
+	switch policy {
+	case "random":
+		return balancer.NewRandom(checker)
+	case "weighted_random":
+		return balancer.NewWeightedRandom(checker)
+	case "p2c":
+		return balancer.NewP2C(checker, nil)
+	case "consistent_hash":
+		return balancer.NewConsistentHash(checker)
+	default:
+		return balancer.NewRoundRobin(checker)
+	}
 }
 
 // Reload Bi-directionally synchronizes config between YAML file and memory.
@@ -62,20 +109,29 @@ func (c *CliConfig) check() error {
 	if c.SessMaxIdleDuration <= 0 {
 		c.SessMaxIdleDuration = time.Minute * 3
 	}
+	c.Forwarding.check()
 	return nil
 }
 
 func (c *CliConfig) peerConfig() tp.PeerConfig {
+	// tp.PeerConfig only recognizes tcp/tcp4/tcp6/unix/unixpacket; a QUIC
+	// scheme is handled entirely by Client's own quicDialer, bypassing
+	// tp.Peer.Dial (and its Network field) via ServeConn instead, so any
+	// value tp.PeerConfig.check() accepts here is fine.
+	network := c.Network
+	if isQUICNetwork(network) {
+		network = "tcp"
+	}
 	return tp.PeerConfig{
 		DefaultReadTimeout:  c.DefaultReadTimeout,
 		DefaultWriteTimeout: c.DefaultWriteTimeout,
-		DefaultDialTimeout:  c.DefaultDialTimeout,
+		DefaultDialTimeout:  c.Forwarding.DialTimeout,
 		RedialTimes:         c.RedialTimes,
 		SlowCometDuration:   c.SlowCometDuration,
 		DefaultBodyCodec:    c.DefaultBodyCodec,
 		PrintBody:           c.PrintBody,
 		CountTime:           c.CountTime,
-		Network:             c.Network,
+		Network:             network,
 	}
 }
 
@@ -84,9 +140,25 @@ type Client struct {
 	peer                *tp.Peer
 	linker              Linker
 	protoFunc           socket.ProtoFunc
+	network             string
+	quicDialer          *quic.Dialer
+	limiter             *ratelimit.Limiter
 	cliSessPool         goutil.Map
 	sessMaxQuota        int
 	sessMaxIdleDuration time.Duration
+	forwarding          ForwardingTimeouts
+	idleReaperStop      chan struct{}
+	breaker             *breaker.Breaker
+	metricsCfg          *metrics.Config
+	metricsReg          prometheus.Registerer
+	metrics             *metrics.Metrics
+	adminSrv            *metrics.AdminServer
+	metricsStop         chan struct{}
+	closeMetricsOnce    sync.Once
+	closeReaperOnce     sync.Once
+	lastUsedMu          sync.Mutex
+	lastUsed            map[string]time.Time
+	evictMu             sync.Mutex
 }
 
 // NewClient creates a client peer.
@@ -104,78 +176,530 @@ func NewClient(cfg CliConfig, plugin ...tp.Plugin) *Client {
 			tp.Fatalf("%v", err)
 		}
 	}
-	return &Client{
+	c := &Client{
 		peer:                peer,
 		protoFunc:           socket.DefaultProtoFunc(),
+		network:             cfg.Network,
 		cliSessPool:         goutil.AtomicMap(),
 		sessMaxQuota:        cfg.SessMaxQuota,
 		sessMaxIdleDuration: cfg.SessMaxIdleDuration,
+		forwarding:          cfg.Forwarding,
+		idleReaperStop:      make(chan struct{}),
+		metricsCfg:          cfg.Metrics,
+		lastUsed:            make(map[string]time.Time),
+	}
+	c.protoFunc = keepAliveProtoFunc(cfg.Forwarding.KeepAlive, c.protoFunc)
+	if cfg.Breaker != nil {
+		c.breaker = breaker.New(*cfg.Breaker)
+	}
+	if cfg.Bandwidth != nil {
+		c.limiter = ratelimit.New(*cfg.Bandwidth)
+		c.protoFunc = c.limiter.ProtoFunc(c.protoFunc)
+	}
+	if len(cfg.Discovery.Endpoints) > 0 {
+		// checker stays a nil balancer.HealthChecker (not a non-nil interface
+		// wrapping a nil *breaker.Breaker) when Breaker is unset, since
+		// filterHealthy's nil check only works against a truly nil interface.
+		var checker balancer.HealthChecker
+		if c.breaker != nil {
+			checker = c.breaker
+		}
+		linker, err := NewDiscoveryLinker(cfg.Discovery, newBalancer(cfg.BalancerPolicy, checker))
+		if err != nil {
+			tp.Fatalf("%v", err)
+		}
+		c.SetLinker(linker)
+	}
+	if isQUICNetwork(cfg.Network) {
+		tlsConfig, err := quicTLSConfig(cfg)
+		if err != nil {
+			tp.Fatalf("%v", err)
+		}
+		c.quicDialer = quic.NewDialer(cfg.Quic, tlsConfig)
+	}
+	go c.idleReaperLoop()
+	return c
+}
+
+// keepAliveProtoFunc wraps next so a connection gets the configured TCP
+// keep-alive applied before any bytes cross it. This is the same hook
+// ratelimit.Limiter.ProtoFunc uses: tp.Peer hands ants a socket.ProtoFunc
+// rather than the raw conn, and the socket.IOWithReadBuffer it passes in
+// implements net.Conn for every transport ants uses, so asserting it down
+// further to the SetKeepAlive/SetKeepAlivePeriod pair - which *net.TCPConn
+// satisfies, but the QUIC streamConn doesn't - is how a dial-layer setting
+// reaches a connection ants itself never dials directly.
+func keepAliveProtoFunc(d time.Duration, next socket.ProtoFunc) socket.ProtoFunc {
+	return func(rw socket.IOWithReadBuffer) socket.Proto {
+		if tc, ok := rw.(interface {
+			SetKeepAlive(bool) error
+			SetKeepAlivePeriod(time.Duration) error
+		}); ok {
+			tc.SetKeepAlive(true)
+			tc.SetKeepAlivePeriod(d)
+		}
+		return next(rw)
+	}
+}
+
+// quicTLSConfig builds the tls.Config a QUIC Network scheme dials with.
+// QUIC terminates TLS itself rather than relying on tp.Peer to wrap the
+// dialed conn in tls.Client afterwards, so it's built straight from
+// TlsCertFile/TlsKeyFile instead of going through peer.SetTlsConfigFromFile.
+// The same cert/key pair is what lets a redial (RedialTimes>0) resume
+// with 0-RTT: the client session cache quic.NewDialer attaches is keyed
+// off this unchanging tls.Config, so repeat dials to the same address
+// reuse its session tickets.
+func quicTLSConfig(cfg CliConfig) (*tls.Config, error) {
+	if len(cfg.TlsCertFile) == 0 || len(cfg.TlsKeyFile) == 0 {
+		return &tls.Config{}, nil
+	}
+	return tp.NewTlsConfigFromFile(cfg.TlsCertFile, cfg.TlsKeyFile)
+}
+
+// idleReaperLoop evicts pooled sessions that have gone unused for longer
+// than Forwarding.IdleConnTimeout, independent of SessMaxIdleDuration.
+func (c *Client) idleReaperLoop() {
+	ticker := time.NewTicker(c.forwarding.IdleConnTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.reapIdleSessions()
+		case <-c.idleReaperStop:
+			return
+		}
+	}
+}
+
+// reapIdleSessions evicts every pooled session whose lastUsed entry is
+// still stale at eviction time. It takes two passes over lastUsed: an
+// initial lock-free-for-the-caller scan to find candidates, then a second,
+// per-addr recheck immediately before evictCliSession is called, so a
+// session touched by a concurrent Pull/Push between the two passes is
+// left alone instead of being closed out from under that call.
+func (c *Client) reapIdleSessions() {
+	now := time.Now()
+	c.lastUsedMu.Lock()
+	stale := make([]string, 0)
+	for addr, t := range c.lastUsed {
+		if now.Sub(t) >= c.forwarding.IdleConnTimeout {
+			stale = append(stale, addr)
+		}
+	}
+	c.lastUsedMu.Unlock()
+	for _, addr := range stale {
+		c.lastUsedMu.Lock()
+		t, ok := c.lastUsed[addr]
+		c.lastUsedMu.Unlock()
+		if !ok || time.Since(t) < c.forwarding.IdleConnTimeout {
+			continue
+		}
+		c.evictCliSession(addr)
+	}
+}
+
+// Breaker returns the Client's circuit breaker, or nil if none is
+// configured. Plugins can use it to observe state transitions, and a
+// HealthChecker-aware Balancer can use it to skip Open addresses.
+func (c *Client) Breaker() *breaker.Breaker {
+	return c.breaker
+}
+
+// SetMetricsRegistry overrides the Prometheus registry ListenMetrics
+// registers its collectors against, instead of prometheus.DefaultRegisterer.
+// Must be called before ListenMetrics.
+func (c *Client) SetMetricsRegistry(reg prometheus.Registerer) {
+	c.metricsReg = reg
+}
+
+// ListenMetrics starts the embedded Prometheus/admin HTTP server described
+// by CliConfig.Metrics. It is a no-op if CliConfig.Metrics was not set.
+// The server runs until Close is called.
+func (c *Client) ListenMetrics() error {
+	if c.metricsCfg == nil {
+		return nil
+	}
+	reg := c.metricsReg
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	c.metrics = metrics.New(reg)
+	if c.breaker != nil {
+		c.breaker.OnStateChange(func(addr string, from, to breaker.State) {
+			if to == breaker.Open {
+				c.metrics.IncCircuitTrip(addr)
+			}
+		})
+	}
+	gatherer, ok := reg.(prometheus.Gatherer)
+	if !ok {
+		gatherer = prometheus.DefaultGatherer
+	}
+	c.adminSrv = metrics.NewAdminServer(*c.metricsCfg, gatherer, c)
+	c.metricsStop = make(chan struct{})
+	go c.refreshIdleGaugesLoop()
+	if c.limiter != nil {
+		go c.refreshBandwidthGaugesLoop()
+	}
+	go func() {
+		if err := c.adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			tp.Errorf("ants: metrics admin server: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Close stops the idle-session reaper and shuts down the embedded metrics
+// admin server, if any. Safe to call more than once.
+func (c *Client) Close() error {
+	c.closeReaperOnce.Do(func() { close(c.idleReaperStop) })
+	if c.adminSrv == nil {
+		return nil
+	}
+	c.closeMetricsOnce.Do(func() { close(c.metricsStop) })
+	return c.adminSrv.Close()
+}
+
+// DumpSessions implements metrics.SessionsDumper for the /debug/sessions
+// admin endpoint.
+func (c *Client) DumpSessions() []metrics.SessionInfo {
+	c.lastUsedMu.Lock()
+	defer c.lastUsedMu.Unlock()
+	now := time.Now()
+	sessions := make([]metrics.SessionInfo, 0, len(c.lastUsed))
+	for addr, t := range c.lastUsed {
+		sessions = append(sessions, metrics.SessionInfo{Addr: addr, IdleFor: now.Sub(t)})
 	}
+	return sessions
 }
 
-// SetProtoFunc sets socket.ProtoFunc.
+// refreshIdleGaugesLoop periodically republishes the idle-session-age
+// gauge for every pooled address, since it only changes on a call's
+// outcome otherwise and would freeze at 0 for addresses that stop being used.
+func (c *Client) refreshIdleGaugesLoop() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.lastUsedMu.Lock()
+			now := time.Now()
+			for addr, t := range c.lastUsed {
+				c.metrics.SetIdleAge(addr, now.Sub(t))
+			}
+			c.lastUsedMu.Unlock()
+		case <-c.metricsStop:
+			return
+		}
+	}
+}
+
+// refreshBandwidthGaugesLoop periodically republishes the bandwidth
+// bucket fill gauges - the global pair, plus one pair per address with a
+// per-session bucket - so operators can see when a bucket is drained,
+// not just that a cap is configured.
+func (c *Client) refreshBandwidthGaugesLoop() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			send, recv := c.limiter.GlobalFill()
+			c.metrics.SetBandwidthFill("send", "", send)
+			c.metrics.SetBandwidthFill("recv", "", recv)
+			for _, addr := range c.limiter.SessionAddrs() {
+				if send, recv, ok := c.limiter.SessionFill(addr); ok {
+					c.metrics.SetBandwidthFill("send", addr, send)
+					c.metrics.SetBandwidthFill("recv", addr, recv)
+				}
+			}
+		case <-c.metricsStop:
+			return
+		}
+	}
+}
+
+// touchSession records addr as just-used, for the open-sessions and
+// idle-session-age gauges and the /debug/sessions dump. isNew marks a
+// freshly-dialed session so the open-sessions gauge is only incremented once.
+func (c *Client) touchSession(addr string, isNew bool) {
+	c.lastUsedMu.Lock()
+	c.lastUsed[addr] = time.Now()
+	c.lastUsedMu.Unlock()
+	if c.metrics != nil {
+		c.metrics.SetIdleAge(addr, 0)
+		if isNew {
+			c.metrics.SetOpenSessions(addr, 1)
+		}
+	}
+}
+
+// SetProtoFunc sets socket.ProtoFunc. protoFunc is wrapped in the same
+// keep-alive and (if CliConfig.Bandwidth is configured) bandwidth-limiter
+// layers the default ProtoFunc was at construction, so callers don't lose
+// either by supplying their own framing.
 func (c *Client) SetProtoFunc(protoFunc socket.ProtoFunc) {
-	c.protoFunc = protoFunc
+	if c.limiter != nil {
+		protoFunc = c.limiter.ProtoFunc(protoFunc)
+	}
+	c.protoFunc = keepAliveProtoFunc(c.forwarding.KeepAlive, protoFunc)
 }
 
 // SetLinker sets Linker.
+// If linker supports eviction notifications (e.g. a discovery linker), the
+// Client subscribes so that a pooled session is closed and removed as soon
+// as its backend address disappears from the discovery source.
 func (c *Client) SetLinker(linker Linker) {
 	c.linker = linker
+	if evictable, ok := linker.(interface{ OnEvict(func(addr string)) }); ok {
+		evictable.OnEvict(c.evictCliSession)
+	}
+}
+
+// evictCliSession closes and removes the pooled session for addr, if any.
+// Serialized by evictMu so the idle reaper, a deadline timeout, and a
+// discovery eviction callback racing on the same addr can't both Close the
+// same session.
+func (c *Client) evictCliSession(addr string) {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+	_cliSess, ok := c.cliSessPool.Load(addr)
+	if !ok {
+		return
+	}
+	c.cliSessPool.Delete(addr)
+	_cliSess.(pooledSession).Close()
+	c.lastUsedMu.Lock()
+	delete(c.lastUsed, addr)
+	c.lastUsedMu.Unlock()
+	if c.limiter != nil {
+		c.limiter.DeleteSession(addr)
+	}
+	if c.metrics != nil {
+		c.metrics.DeleteAddr(addr)
+	}
 }
 
 // AsyncPull sends a packet and receives reply asynchronously.
 // If the args is []byte or *[]byte type, it can automatically fill in the body codec name.
+// The call is bounded by a WithDeadline setting, or else by
+// Forwarding.ResponseHeaderTimeout; if it passes before cliSess replies,
+// done instead receives NewErrDeadlineExceeded and addr's pooled session
+// is evicted. Note this only abandons waiting for the reply — the
+// underlying cliSess.AsyncPull goroutine keeps running and may still
+// write into reply after done has already fired, so a caller whose
+// deadline fires must not reuse reply until it independently knows that
+// goroutine is done (e.g. by discarding it and allocating a fresh one).
 func (c *Client) AsyncPull(uri string, args interface{}, reply interface{}, done chan tp.PullCmd, setting ...socket.PacketSetting) {
-	cliSess, rerr := c.getCliSession(uri)
+	start := time.Now()
+	cliSess, addr, rerr := c.getCliSession(uri, setting)
 	if rerr != nil {
+		c.recordMetrics("async_pull", args, start, rerr)
 		done <- cliSession.NewFakePullCmd(c.peer, uri, args, reply, rerr, setting...)
 		return
 	}
-	cliSess.AsyncPull(uri, args, reply, done, setting...)
+	deadline := c.effectiveDeadline(time.Now(), setting)
+	innerDone := make(chan tp.PullCmd, 1)
+	cliSess.AsyncPull(uri, args, reply, innerDone, setting...)
+	go func() {
+		pullCmd := c.awaitDeadline(addr, innerDone, deadline, func() tp.PullCmd {
+			return cliSession.NewFakePullCmd(c.peer, uri, args, reply, NewErrDeadlineExceeded(addr), setting...)
+		})
+		c.recordBreaker(addr, pullCmd.Rerror())
+		c.recordMetrics("async_pull", args, start, pullCmd.Rerror())
+		done <- pullCmd
+	}()
 }
 
 // Pull sends a packet and receives reply.
 // Note:
 // If the args is []byte or *[]byte type, it can automatically fill in the body codec name;
 // If the session is a client role and PeerConfig.RedialTimes>0, it is automatically re-called once after a failure.
+// The call is bounded by a WithDeadline setting, or else by
+// Forwarding.ResponseHeaderTimeout; if it passes before cliSess replies,
+// Pull returns NewErrDeadlineExceeded and addr's pooled session is evicted
+// rather than left to be reused mid-call. See AsyncPull's doc for why
+// reply must not be reused immediately after a timeout.
 func (c *Client) Pull(uri string, args interface{}, reply interface{}, setting ...socket.PacketSetting) tp.PullCmd {
-	cliSess, rerr := c.getCliSession(uri)
+	start := time.Now()
+	cliSess, addr, rerr := c.getCliSession(uri, setting)
 	if rerr != nil {
+		c.recordMetrics("pull", args, start, rerr)
 		return cliSession.NewFakePullCmd(c.peer, uri, args, reply, rerr, setting...)
 	}
-	return cliSess.Pull(uri, args, reply, setting...)
+	deadline := c.effectiveDeadline(time.Now(), setting)
+	innerDone := make(chan tp.PullCmd, 1)
+	go func() { innerDone <- cliSess.Pull(uri, args, reply, setting...) }()
+	pullCmd := c.awaitDeadline(addr, innerDone, deadline, func() tp.PullCmd {
+		return cliSession.NewFakePullCmd(c.peer, uri, args, reply, NewErrDeadlineExceeded(addr), setting...)
+	})
+	c.recordBreaker(addr, pullCmd.Rerror())
+	c.recordMetrics("pull", args, start, pullCmd.Rerror())
+	return pullCmd
 }
 
 // Push sends a packet, but do not receives reply.
 // Note:
 // If the args is []byte or *[]byte type, it can automatically fill in the body codec name;
 // If the session is a client role and PeerConfig.RedialTimes>0, it is automatically re-called once after a failure.
+// The call is bounded the same way as Pull.
 func (c *Client) Push(uri string, args interface{}, setting ...socket.PacketSetting) *tp.Rerror {
-	cliSess, rerr := c.getCliSession(uri)
+	start := time.Now()
+	cliSess, addr, rerr := c.getCliSession(uri, setting)
 	if rerr != nil {
+		c.recordMetrics("push", args, start, rerr)
+		return rerr
+	}
+	deadline := c.effectiveDeadline(time.Now(), setting)
+	innerDone := make(chan *tp.Rerror, 1)
+	go func() { innerDone <- cliSess.Push(uri, args, setting...) }()
+	rerr = c.awaitRerrorDeadline(addr, innerDone, deadline)
+	c.recordBreaker(addr, rerr)
+	c.recordMetrics("push", args, start, rerr)
+	return rerr
+}
+
+// effectiveDeadline returns the call's WithDeadline setting, or else
+// dispatchStart+Forwarding.ResponseHeaderTimeout. dispatchStart should be
+// taken right before the request is handed to cliSess, not before
+// getCliSession — address selection and, on a pool miss, establishing the
+// session are bounded separately (by the breaker and DialTimeout) and
+// shouldn't eat into the reply-wait budget.
+func (c *Client) effectiveDeadline(dispatchStart time.Time, setting []socket.PacketSetting) time.Time {
+	if deadline, ok := deadlineFromSetting(setting); ok {
+		return deadline
+	}
+	return dispatchStart.Add(c.forwarding.ResponseHeaderTimeout)
+}
+
+// awaitDeadline waits on innerDone until deadline, returning its value if
+// it arrives in time. Otherwise it evicts addr's pooled session (it may
+// still be blocked completing the very call that timed out, so it must
+// not be reused) and returns onExpire's fake command instead.
+func (c *Client) awaitDeadline(addr string, innerDone chan tp.PullCmd, deadline time.Time, onExpire func() tp.PullCmd) tp.PullCmd {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case pullCmd := <-innerDone:
+		return pullCmd
+	case <-timer.C:
+		c.evictCliSession(addr)
+		return onExpire()
+	}
+}
+
+// awaitRerrorDeadline is awaitDeadline's Push-shaped counterpart: Push has
+// no reply to fabricate on expiry, only a *tp.Rerror, so it can't share
+// awaitDeadline's onExpire signature.
+func (c *Client) awaitRerrorDeadline(addr string, innerDone chan *tp.Rerror, deadline time.Time) *tp.Rerror {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case rerr := <-innerDone:
 		return rerr
+	case <-timer.C:
+		c.evictCliSession(addr)
+		return NewErrDeadlineExceeded(addr)
+	}
+}
+
+// recordBreaker feeds the outcome of a call to addr's circuit, a no-op if
+// no breaker is configured. If ListenMetrics is also active, a trip into
+// the Open state is reported to the metrics circuit-trips counter via the
+// breaker's own OnStateChange hook, registered there.
+func (c *Client) recordBreaker(addr string, rerr *tp.Rerror) {
+	if c.breaker == nil {
+		return
+	}
+	if rerr != nil {
+		c.breaker.Failure(addr)
+	} else {
+		c.breaker.Success(addr)
 	}
-	return cliSess.Push(uri, args, setting...)
 }
 
-func (c *Client) getCliSession(uri string) (*cliSession.CliSession, *tp.Rerror) {
+// recordMetrics is a no-op if no Metrics is configured, otherwise it
+// observes one request's outcome: its kind, *tp.Rerror code (0 on
+// success), elapsed time since start, and approximate body size.
+func (c *Client) recordMetrics(kind string, args interface{}, start time.Time, rerr *tp.Rerror) {
+	if c.metrics == nil {
+		return
+	}
+	var code int32
+	if rerr != nil {
+		code = rerr.Code
+	}
+	c.metrics.ObserveRequest(kind, code, time.Since(start), approxBodySize(args))
+}
+
+// selectAddr resolves uri to an endpoint, consulting a hash key supplied
+// via WithHashKey when the configured Linker supports hash-based balancing.
+func (c *Client) selectAddr(uri string, setting []socket.PacketSetting) (string, *tp.Rerror) {
+	if hl, ok := c.linker.(HashLinker); ok {
+		return hl.SelectHash(uri, hashKeyFromSetting(setting))
+	}
+	return c.linker.Select(uri)
+}
+
+// getCliSession resolves uri to a pooled session, returning the resolved
+// address too so callers can feed the call's outcome back to the circuit
+// breaker. If the breaker considers addr Open, it fails fast with
+// NewErrCircuitOpen without touching cliSessPool.
+func (c *Client) getCliSession(uri string, setting []socket.PacketSetting) (pooledSession, string, *tp.Rerror) {
 	if idx := strings.Index(uri, "?"); idx != -1 {
 		uri = uri[:idx]
 	}
-	addr, rerr := c.linker.Select(uri)
+	addr, rerr := c.selectAddr(uri, setting)
 	if rerr != nil {
-		return nil, rerr
+		return nil, "", rerr
+	}
+	if c.breaker != nil && !c.breaker.Allow(addr) {
+		return nil, addr, NewErrCircuitOpen(addr)
 	}
 	_cliSess, ok := c.cliSessPool.Load(addr)
 	if ok {
-		return _cliSess.(*cliSession.CliSession), nil
-	}
-	cliSess := cliSession.New(
-		c.peer,
-		addr,
-		c.sessMaxQuota,
-		c.sessMaxIdleDuration,
-	)
+		c.touchSession(addr, false)
+		return _cliSess.(pooledSession), addr, nil
+	}
+	var cliSess pooledSession
+	if c.quicDialer != nil {
+		cliSess = newQUICCliSession(
+			c.peer,
+			addr,
+			c.sessMaxQuota,
+			c.sessMaxIdleDuration,
+			c.forwarding.DialTimeout,
+			c.quicDialer,
+			c.network,
+			c.protoFunc,
+		)
+	} else {
+		cliSess = cliSession.New(
+			c.peer,
+			addr,
+			c.sessMaxQuota,
+			c.sessMaxIdleDuration,
+			c.protoFunc,
+		)
+	}
 	c.cliSessPool.Store(addr, cliSess)
-	return cliSess, nil
-}
\ No newline at end of file
+	c.touchSession(addr, true)
+	return cliSess, addr, nil
+}
+
+// approxBodySize estimates a request's body size for the body-size
+// histogram. Mirrors the []byte / *[]byte auto-body-codec cases Pull,
+// AsyncPull and Push already special-case; any other type is sized as 0
+// rather than paying for a reflective encode on the hot path.
+func approxBodySize(args interface{}) int {
+	switch b := args.(type) {
+	case []byte:
+		return len(b)
+	case *[]byte:
+		if b != nil {
+			return len(*b)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ants
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/henrylee2cn/teleport/socket"
+)
+
+// deadlineMetaKey is the packet meta key used to carry a caller-supplied
+// per-call deadline from WithDeadline through to Client.
+const deadlineMetaKey = "ants-deadline"
+
+// WithDeadline bounds a single Pull/AsyncPull/Push call to t, overriding
+// CliConfig.Forwarding.ResponseHeaderTimeout (which would otherwise bound
+// it) for that call. On expiry the call returns NewErrDeadlineExceeded and
+// its underlying pooled session is closed and evicted rather than reused;
+// note the original cliSession call keeps running in the background and
+// may still write into the caller's reply afterwards, so reply must not
+// be reused until the caller is otherwise sure that goroutine has exited.
+func WithDeadline(t time.Time) socket.PacketSetting {
+	return socket.WithSetMeta(deadlineMetaKey, strconv.FormatInt(t.UnixNano(), 10))
+}
+
+// deadlineFromSetting replays setting against a throwaway packet so the
+// deadline (if any) can be read back before the call is dispatched.
+func deadlineFromSetting(setting []socket.PacketSetting) (time.Time, bool) {
+	if len(setting) == 0 {
+		return time.Time{}, false
+	}
+	packet := socket.GetPacket(setting...)
+	defer socket.PutPacket(packet)
+	nanos := packet.Meta().GetString(deadlineMetaKey)
+	if nanos == "" {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n), true
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// consulBackend implements backend on top of the Consul KV store, using
+// blocking queries (WaitIndex) as the watch mechanism.
+type consulBackend struct {
+	cli *consul.Client
+}
+
+func newConsulBackend(cfg Config) (backend, error) {
+	ccfg := consul.DefaultConfig()
+	if len(cfg.Endpoints) > 0 {
+		ccfg.Address = cfg.Endpoints[0]
+	}
+	ccfg.WaitTime = cfg.DialTimeout
+	cli, err := consul.NewClient(ccfg)
+	if err != nil {
+		return nil, err
+	}
+	return &consulBackend{cli: cli}, nil
+}
+
+func (b *consulBackend) list(keyPrefix string) ([]string, error) {
+	pairs, _, err := b.cli.KV().List(keyPrefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		addrs = append(addrs, string(p.Value))
+	}
+	return addrs, nil
+}
+
+func (b *consulBackend) watch(keyPrefix string, stop <-chan struct{}) (<-chan event, error) {
+	out := make(chan event)
+	go func() {
+		defer close(out)
+		var lastIndex uint64
+		seen := map[string]string{}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			pairs, meta, err := b.cli.KV().List(keyPrefix, &consul.QueryOptions{
+				WaitIndex: lastIndex,
+			})
+			if err != nil {
+				return
+			}
+			lastIndex = meta.LastIndex
+
+			current := map[string]string{}
+			for _, p := range pairs {
+				current[p.Key] = string(p.Value)
+			}
+			for k, v := range current {
+				if prev, ok := seen[k]; !ok || prev != v {
+					out <- event{typ: eventPut, addr: v}
+				}
+			}
+			for k, v := range seen {
+				if _, ok := current[k]; !ok {
+					out <- event{typ: eventDelete, addr: v}
+				}
+			}
+			seen = current
+		}
+	}()
+	return out, nil
+}
+
+func (b *consulBackend) put(key, addr string, ttl time.Duration, stop <-chan struct{}) error {
+	if _, err := b.cli.KV().Put(&consul.KVPair{Key: key, Value: []byte(addr)}, nil); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				b.cli.KV().Delete(key, nil)
+				return
+			case <-ticker.C:
+				b.cli.KV().Put(&consul.KVPair{Key: key, Value: []byte(addr)}, nil)
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *consulBackend) close() error {
+	return nil
+}
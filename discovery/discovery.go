@@ -0,0 +1,316 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package discovery implements dynamic service discovery for ants, backed
+// by etcd (and optionally Consul), so a Linker can resolve a URI prefix to
+// a live, rotating set of service endpoints instead of one static address.
+package discovery
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoEndpoint is returned when a service has no known endpoints.
+var ErrNoEndpoint = errors.New("discovery: no available endpoint")
+
+// Config is the common configuration shared by the client watcher and the
+// server-side registrar.
+type Config struct {
+	// Endpoints is the list of backend addresses (etcd or consul) to dial.
+	Endpoints []string `yaml:"endpoints"      ini:"endpoints"      comment:"Discovery backend endpoints, comma-separated host:port list"`
+	// DialTimeout bounds how long to wait while connecting to the backend.
+	DialTimeout time.Duration `yaml:"dial_timeout"   ini:"dial_timeout"   comment:"Discovery backend dial timeout; ns,µs,ms,s,m,h"`
+	// Namespace prefixes every key written to or watched in the backend,
+	// so multiple environments can share one etcd/consul cluster.
+	Namespace string `yaml:"namespace"      ini:"namespace"      comment:"Key namespace prefix, e.g. /ants/prod"`
+	// Backend selects which discovery backend to use: "etcd" (default) or "consul".
+	Backend string `yaml:"backend"        ini:"backend"        comment:"Discovery backend: etcd or consul"`
+}
+
+func (c *Config) check() {
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = 5 * time.Second
+	}
+	if c.Backend == "" {
+		c.Backend = "etcd"
+	}
+}
+
+// key builds the full backend key for a service name under the namespace.
+func (c *Config) key(serviceName string) string {
+	return strings.TrimRight(c.Namespace, "/") + "/" + strings.TrimLeft(serviceName, "/")
+}
+
+// keyPrefix builds the full backend key prefix used to watch a whole service.
+func (c *Config) keyPrefix(serviceName string) string {
+	return c.key(serviceName) + "/"
+}
+
+// backend abstracts the underlying KV/watch store so both etcd and Consul
+// can drive the same Watcher and Registrar logic.
+type backend interface {
+	// list returns the current addresses registered under keyPrefix.
+	list(keyPrefix string) ([]string, error)
+	// watch streams add/remove events for keys under keyPrefix until stop is closed.
+	watch(keyPrefix string, stop <-chan struct{}) (<-chan event, error)
+	// put registers addr under key with the given TTL, refreshing it with keep-alive.
+	put(key, addr string, ttl time.Duration, stop <-chan struct{}) error
+	// close releases the backend connection.
+	close() error
+}
+
+type eventType int
+
+const (
+	eventPut eventType = iota
+	eventDelete
+)
+
+type event struct {
+	typ  eventType
+	addr string
+}
+
+func newBackend(cfg Config) (backend, error) {
+	switch cfg.Backend {
+	case "consul":
+		return newConsulBackend(cfg)
+	default:
+		return newEtcdBackend(cfg)
+	}
+}
+
+// Watcher maintains a live, rotating set of endpoints for each watched
+// service, resynced from scratch whenever the backend connection recovers
+// from a lost watch.
+type Watcher struct {
+	cfg     Config
+	backend backend
+
+	mu        sync.RWMutex
+	endpoints map[string][]string // serviceName -> addrs
+	next      map[string]uint64   // serviceName -> round-robin cursor
+
+	onRemove func(addr string)
+
+	stop   chan struct{}
+	closed bool
+}
+
+// NewWatcher creates a Watcher and connects to the configured backend.
+func NewWatcher(cfg Config) (*Watcher, error) {
+	cfg.check()
+	b, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		cfg:       cfg,
+		backend:   b,
+		endpoints: make(map[string][]string),
+		next:      make(map[string]uint64),
+		stop:      make(chan struct{}),
+	}, nil
+}
+
+// OnRemove registers a callback invoked with the address of an endpoint
+// that just disappeared from the watch, so callers (e.g. Client) can close
+// and evict any pooled session for it.
+func (w *Watcher) OnRemove(fn func(addr string)) {
+	w.mu.Lock()
+	w.onRemove = fn
+	w.mu.Unlock()
+}
+
+// Watch starts (or resumes) watching serviceName, populating the initial
+// endpoint list synchronously before returning.
+func (w *Watcher) Watch(serviceName string) error {
+	prefix := w.cfg.keyPrefix(serviceName)
+	addrs, err := w.backend.list(prefix)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.endpoints[serviceName] = addrs
+	w.mu.Unlock()
+
+	ch, err := w.backend.watch(prefix, w.stop)
+	if err != nil {
+		return err
+	}
+	go w.loop(serviceName, prefix, ch)
+	return nil
+}
+
+// loop applies incremental events to the in-memory endpoint set and
+// triggers a full resync of the key space whenever the watch channel
+// closes (lost connection) and later recovers.
+func (w *Watcher) loop(serviceName, prefix string, ch <-chan event) {
+	for {
+		select {
+		case <-w.stop:
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				// watch connection lost; back off and resync the full key space.
+				if w.resync(serviceName, prefix) {
+					return
+				}
+				continue
+			}
+			w.apply(serviceName, ev)
+		}
+	}
+}
+
+// resync re-establishes the watch after a disconnect, retrying with
+// backoff until it succeeds or the Watcher is closed.
+func (w *Watcher) resync(serviceName, prefix string) (stopped bool) {
+	backoff := 200 * time.Millisecond
+	const maxBackoff = 30 * time.Second
+	for {
+		select {
+		case <-w.stop:
+			return true
+		case <-time.After(backoff):
+		}
+		addrs, err := w.backend.list(prefix)
+		if err != nil {
+			if backoff < maxBackoff {
+				backoff *= 2
+			}
+			continue
+		}
+		w.mu.Lock()
+		w.endpoints[serviceName] = addrs
+		w.mu.Unlock()
+
+		ch, err := w.backend.watch(prefix, w.stop)
+		if err != nil {
+			if backoff < maxBackoff {
+				backoff *= 2
+			}
+			continue
+		}
+		go w.loop(serviceName, prefix, ch)
+		return false
+	}
+}
+
+func (w *Watcher) apply(serviceName string, ev event) {
+	w.mu.Lock()
+	addrs := w.endpoints[serviceName]
+	switch ev.typ {
+	case eventPut:
+		found := false
+		for _, a := range addrs {
+			if a == ev.addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addrs = append(addrs, ev.addr)
+		}
+	case eventDelete:
+		for i, a := range addrs {
+			if a == ev.addr {
+				addrs = append(addrs[:i], addrs[i+1:]...)
+				break
+			}
+		}
+	}
+	w.endpoints[serviceName] = addrs
+	onRemove := w.onRemove
+	w.mu.Unlock()
+
+	if ev.typ == eventDelete && onRemove != nil {
+		onRemove(ev.addr)
+	}
+}
+
+// Next returns the next endpoint for serviceName in round-robin order.
+// It returns ErrNoEndpoint if no endpoint is currently known.
+func (w *Watcher) Next(serviceName string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	addrs := w.endpoints[serviceName]
+	if len(addrs) == 0 {
+		return "", ErrNoEndpoint
+	}
+	idx := w.next[serviceName] % uint64(len(addrs))
+	w.next[serviceName] = idx + 1
+	return addrs[idx], nil
+}
+
+// Endpoints returns a snapshot of the currently known endpoints for serviceName.
+func (w *Watcher) Endpoints(serviceName string) []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	addrs := w.endpoints[serviceName]
+	out := make([]string, len(addrs))
+	copy(out, addrs)
+	return out
+}
+
+// Close stops all watches and releases the backend connection.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.stop)
+	return w.backend.close()
+}
+
+// Registrar publishes `service_name -> host:port` with a TTL lease and
+// keeps it alive for as long as it is running, for use on the server side.
+type Registrar struct {
+	cfg     Config
+	backend backend
+	stop    chan struct{}
+}
+
+// NewRegistrar creates a Registrar and connects to the configured backend.
+func NewRegistrar(cfg Config) (*Registrar, error) {
+	cfg.check()
+	b, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Registrar{
+		cfg:     cfg,
+		backend: b,
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// Register publishes addr under serviceName with the given TTL and keeps
+// it alive in the background until Close is called.
+func (r *Registrar) Register(serviceName, addr string, ttl time.Duration) error {
+	key := r.cfg.key(serviceName) + "/" + addr
+	return r.backend.put(key, addr, ttl, r.stop)
+}
+
+// Close stops the keep-alive and releases the backend connection.
+func (r *Registrar) Close() error {
+	close(r.stop)
+	return r.backend.close()
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeBackend is an in-memory backend used to drive Watcher/Registrar logic
+// without a real etcd or Consul cluster.
+type fakeBackend struct {
+	addrs  []string
+	events chan event
+}
+
+func newFakeBackend(addrs ...string) *fakeBackend {
+	return &fakeBackend{addrs: addrs, events: make(chan event, 8)}
+}
+
+func (b *fakeBackend) list(string) ([]string, error) {
+	return b.addrs, nil
+}
+
+func (b *fakeBackend) watch(_ string, stop <-chan struct{}) (<-chan event, error) {
+	out := make(chan event)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-stop:
+				return
+			case ev, ok := <-b.events:
+				if !ok {
+					return
+				}
+				out <- ev
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (b *fakeBackend) put(string, string, time.Duration, <-chan struct{}) error {
+	return nil
+}
+
+func (b *fakeBackend) close() error {
+	return nil
+}
+
+func newTestWatcher(b backend) *Watcher {
+	return &Watcher{
+		cfg:       Config{Namespace: "/ants/test"},
+		backend:   b,
+		endpoints: make(map[string][]string),
+		next:      make(map[string]uint64),
+		stop:      make(chan struct{}),
+	}
+}
+
+func waitForEndpoints(t *testing.T, w *Watcher, serviceName string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if len(w.Endpoints(serviceName)) == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("endpoints for %q never reached length %d, got %v", serviceName, want, w.Endpoints(serviceName))
+}
+
+func TestWatcherInitialList(t *testing.T) {
+	b := newFakeBackend("10.0.0.1:80", "10.0.0.2:80")
+	w := newTestWatcher(b)
+	defer w.Close()
+
+	if err := w.Watch("svc"); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	addrs := w.Endpoints("svc")
+	if len(addrs) != 2 {
+		t.Fatalf("Endpoints = %v, want 2 entries", addrs)
+	}
+}
+
+func TestWatcherAppliesPutAndDelete(t *testing.T) {
+	b := newFakeBackend("10.0.0.1:80")
+	w := newTestWatcher(b)
+	defer w.Close()
+
+	if err := w.Watch("svc"); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	waitForEndpoints(t, w, "svc", 1)
+
+	b.events <- event{typ: eventPut, addr: "10.0.0.2:80"}
+	waitForEndpoints(t, w, "svc", 2)
+
+	b.events <- event{typ: eventPut, addr: "10.0.0.2:80"}
+	waitForEndpoints(t, w, "svc", 2) // duplicate put must not grow the set
+
+	var removed string
+	done := make(chan struct{})
+	w.OnRemove(func(addr string) {
+		removed = addr
+		close(done)
+	})
+
+	b.events <- event{typ: eventDelete, addr: "10.0.0.1:80"}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for OnRemove to fire")
+	}
+	if removed != "10.0.0.1:80" {
+		t.Fatalf("OnRemove addr = %q, want 10.0.0.1:80", removed)
+	}
+	waitForEndpoints(t, w, "svc", 1)
+	addrs := w.Endpoints("svc")
+	if len(addrs) != 1 || addrs[0] != "10.0.0.2:80" {
+		t.Fatalf("Endpoints after delete = %v, want [10.0.0.2:80]", addrs)
+	}
+}
+
+func TestWatcherNextRoundRobin(t *testing.T) {
+	b := newFakeBackend("a", "b")
+	w := newTestWatcher(b)
+	defer w.Close()
+
+	if err := w.Watch("svc"); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	first, err := w.Next("svc")
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	second, err := w.Next("svc")
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if first == second {
+		t.Fatalf("Next returned %q twice in a row across a 2-endpoint set", first)
+	}
+	third, err := w.Next("svc")
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if third != first {
+		t.Fatalf("Next did not wrap back to %q after 2 calls, got %q", first, third)
+	}
+}
+
+func TestWatcherNextNoEndpoint(t *testing.T) {
+	w := newTestWatcher(newFakeBackend())
+	defer w.Close()
+
+	if _, err := w.Next("unknown"); err != ErrNoEndpoint {
+		t.Fatalf("Next on an unwatched service: err = %v, want ErrNoEndpoint", err)
+	}
+}
+
+func TestConfigKeyPrefix(t *testing.T) {
+	cfg := Config{Namespace: "/ants/prod/"}
+	if got, want := cfg.key("aaa"), "/ants/prod/aaa"; got != want {
+		t.Fatalf("key = %q, want %q", got, want)
+	}
+	if got, want := cfg.keyPrefix("aaa"), "/ants/prod/aaa/"; got != want {
+		t.Fatalf("keyPrefix = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// etcdBackend implements backend on top of an etcd v3 client.
+type etcdBackend struct {
+	cli *etcd.Client
+}
+
+func newEtcdBackend(cfg Config) (backend, error) {
+	cli, err := etcd.New(etcd.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: cfg.DialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &etcdBackend{cli: cli}, nil
+}
+
+func (b *etcdBackend) list(keyPrefix string) ([]string, error) {
+	resp, err := b.cli.Get(context.Background(), keyPrefix, etcd.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		addrs = append(addrs, string(kv.Value))
+	}
+	return addrs, nil
+}
+
+func (b *etcdBackend) watch(keyPrefix string, stop <-chan struct{}) (<-chan event, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wch := b.cli.Watch(ctx, keyPrefix, etcd.WithPrefix(), etcd.WithPrevKV())
+	out := make(chan event)
+	go func() {
+		defer cancel()
+		defer close(out)
+		for {
+			select {
+			case <-stop:
+				return
+			case resp, ok := <-wch:
+				if !ok {
+					return
+				}
+				if err := resp.Err(); err != nil {
+					return
+				}
+				for _, ev := range resp.Events {
+					switch ev.Type {
+					case etcd.EventTypePut:
+						out <- event{typ: eventPut, addr: string(ev.Kv.Value)}
+					case etcd.EventTypeDelete:
+						out <- event{typ: eventDelete, addr: string(ev.PrevKv.Value)}
+					}
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (b *etcdBackend) put(key, addr string, ttl time.Duration, stop <-chan struct{}) error {
+	ctx := context.Background()
+	lease, err := b.cli.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return err
+	}
+	if _, err := b.cli.Put(ctx, key, addr, etcd.WithLease(lease.ID)); err != nil {
+		return err
+	}
+	keepAlive, err := b.cli.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case _, ok := <-keepAlive:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *etcdBackend) close() error {
+	return b.cli.Close()
+}
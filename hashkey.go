@@ -0,0 +1,41 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ants
+
+import (
+	"github.com/henrylee2cn/teleport/socket"
+)
+
+// hashKeyMetaKey is the packet meta key used to carry a caller-supplied
+// hash-balancing key from WithHashKey through to the Linker.
+const hashKeyMetaKey = "ants-hash-key"
+
+// WithHashKey attaches a hash key to the call, consulted by a HashLinker's
+// consistent-hash Balancer to route calls sharing the same key to the same
+// endpoint. It is a no-op against linkers that don't support hashing.
+func WithHashKey(hashKey string) socket.PacketSetting {
+	return socket.WithSetMeta(hashKeyMetaKey, hashKey)
+}
+
+// hashKeyFromSetting replays setting against a throwaway packet so the
+// hash key (if any) can be read back before a session is resolved.
+func hashKeyFromSetting(setting []socket.PacketSetting) string {
+	if len(setting) == 0 {
+		return ""
+	}
+	packet := socket.GetPacket(setting...)
+	defer socket.PutPacket(packet)
+	return packet.Meta().GetString(hashKeyMetaKey)
+}
@@ -15,7 +15,13 @@
 package ants
 
 import (
+	"strings"
+	"sync"
+
 	tp "github.com/henrylee2cn/teleport"
+
+	"github.com/henrylee2cn/ants/balancer"
+	"github.com/henrylee2cn/ants/discovery"
 )
 
 // Linker linker for client.
@@ -23,6 +29,15 @@ type Linker interface {
 	Select(uriPath string) (string, *tp.Rerror)
 }
 
+// HashLinker is an optional extension of Linker for implementations that
+// support hash-based balancing policies (e.g. consistent hashing). Client
+// uses it when a call supplies a hash key via socket.PacketSetting, falling
+// back to plain Select otherwise.
+type HashLinker interface {
+	Linker
+	SelectHash(uriPath, hashKey string) (string, *tp.Rerror)
+}
+
 // static linker
 
 // NewStaticLinker creates a static linker.
@@ -40,4 +55,88 @@ func (d *staticLinker) Select(string) (string, *tp.Rerror) {
 	return d.srvAddr, nil
 }
 
-// dynamic linker
\ No newline at end of file
+// dynamic linker
+
+// NewDiscoveryLinker creates a dynamic linker backed by an etcd/Consul
+// service registry. It resolves a uriPath like "/aaa/xx_zz" to the service
+// named by its first path segment ("aaa"), using bal to pick one endpoint
+// out of whatever is currently registered for that service. bal defaults
+// to round-robin when nil.
+func NewDiscoveryLinker(cfg discovery.Config, bal balancer.Balancer) (Linker, error) {
+	w, err := discovery.NewWatcher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if bal == nil {
+		bal = balancer.NewRoundRobin(nil)
+	}
+	return &discoveryLinker{
+		watcher: w,
+		bal:     bal,
+		watched: make(map[string]bool),
+	}, nil
+}
+
+type discoveryLinker struct {
+	watcher *discovery.Watcher
+	bal     balancer.Balancer
+
+	watchedMu sync.Mutex
+	watched   map[string]bool
+}
+
+// serviceName extracts the leading path segment that names the service,
+// e.g. "/aaa/xx_zz" -> "aaa".
+func serviceName(uriPath string) string {
+	uriPath = strings.TrimPrefix(uriPath, "/")
+	if idx := strings.Index(uriPath, "/"); idx != -1 {
+		uriPath = uriPath[:idx]
+	}
+	return uriPath
+}
+
+func (d *discoveryLinker) Select(uriPath string) (string, *tp.Rerror) {
+	return d.SelectHash(uriPath, "")
+}
+
+// SelectHash resolves uriPath to one endpoint, consulting hashKey when the
+// configured Balancer is hash-based.
+func (d *discoveryLinker) SelectHash(uriPath, hashKey string) (string, *tp.Rerror) {
+	name := serviceName(uriPath)
+	d.ensureWatched(name)
+	addrs := d.watcher.Endpoints(name)
+	endpoints := make([]balancer.Endpoint, len(addrs))
+	for i, addr := range addrs {
+		endpoints[i] = balancer.Endpoint{Addr: addr, Weight: 1}
+	}
+	addr, err := d.bal.Pick(hashKey, endpoints)
+	if err != nil {
+		return "", tp.NewRerror(tp.CodeDialFailed, "no available endpoint", err.Error())
+	}
+	return addr, nil
+}
+
+func (d *discoveryLinker) ensureWatched(name string) {
+	d.watchedMu.Lock()
+	defer d.watchedMu.Unlock()
+	if d.watched[name] {
+		return
+	}
+	// ignore the error: Select will surface ErrNoEndpoint on every call
+	// until the backend becomes reachable and a later ensureWatched succeeds.
+	if err := d.watcher.Watch(name); err == nil {
+		d.watched[name] = true
+	}
+}
+
+// OnEvict registers fn to be called with the address of an endpoint that
+// just disappeared from discovery, so a Client can evict it from its
+// pooled sessions.
+func (d *discoveryLinker) OnEvict(fn func(addr string)) {
+	d.watcher.OnRemove(fn)
+}
+
+// Close stops all discovery watches held by the linker.
+func (d *discoveryLinker) Close() error {
+	return d.watcher.Close()
+}
\ No newline at end of file
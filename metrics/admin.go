@@ -0,0 +1,104 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// User is one basic-auth account permitted to reach the admin endpoint.
+type User struct {
+	Name string `yaml:"name"        ini:"name"        comment:"Basic-auth username"`
+	// BcryptHash is the bcrypt hash of the account's password, e.g. as
+	// produced by `htpasswd -nbBC 10 <user> <pass>`. Plaintext passwords
+	// are never stored in config.
+	BcryptHash string `yaml:"bcrypt_hash" ini:"bcrypt_hash" comment:"bcrypt hash of the account password"`
+}
+
+// Config configures the embedded admin HTTP server that serves /metrics
+// and /debug/sessions.
+// Note:
+//  yaml tag is used for github.com/henrylee2cn/cfgo
+//  ini tag is used for github.com/henrylee2cn/ini
+type Config struct {
+	ListenAddress string `yaml:"listen_address" ini:"listen_address" comment:"Admin HTTP server listen address, such as 0.0.0.0:6060; leave empty to disable"`
+	TlsCertFile   string `yaml:"tls_cert_file"   ini:"tls_cert_file"   comment:"TLS certificate file path for the admin server"`
+	TlsKeyFile    string `yaml:"tls_key_file"    ini:"tls_key_file"    comment:"TLS key file path for the admin server"`
+	Users         []User `yaml:"users"           ini:"users"           comment:"Basic-auth accounts permitted to reach the admin endpoint; leave empty to disable auth"`
+}
+
+// SessionInfo is one row of the /debug/sessions dump.
+type SessionInfo struct {
+	Addr    string        `json:"addr"`
+	IdleFor time.Duration `json:"idle_for"`
+}
+
+// SessionsDumper supplies the live pooled-session snapshot served at
+// /debug/sessions. Client implements it.
+type SessionsDumper interface {
+	DumpSessions() []SessionInfo
+}
+
+// AdminServer is the embedded HTTP server exposing /metrics and
+// /debug/sessions for one Client or Server.
+type AdminServer struct {
+	cfg Config
+	srv *http.Server
+}
+
+// NewAdminServer builds, but does not start, the admin server for gatherer
+// and dumper. dumper may be nil (e.g. for a Server, which pools no
+// outbound sessions), in which case /debug/sessions is not mounted. Call
+// ListenAndServe (typically in a goroutine) to start it.
+func NewAdminServer(cfg Config, gatherer prometheus.Gatherer, dumper SessionsDumper) *AdminServer {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	if dumper != nil {
+		mux.HandleFunc("/debug/sessions", func(w http.ResponseWriter, r *http.Request) {
+			sessions := dumper.DumpSessions()
+			sort.Slice(sessions, func(i, j int) bool { return sessions[i].Addr < sessions[j].Addr })
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sessions)
+		})
+	}
+	var handler http.Handler = mux
+	if len(cfg.Users) > 0 {
+		handler = basicAuth(cfg.Users, handler)
+	}
+	return &AdminServer{
+		cfg: cfg,
+		srv: &http.Server{Addr: cfg.ListenAddress, Handler: handler},
+	}
+}
+
+// ListenAndServe starts the admin server and blocks until it stops or
+// fails. Callers typically run it in a goroutine and stop it with Close.
+func (a *AdminServer) ListenAndServe() error {
+	if len(a.cfg.TlsCertFile) > 0 && len(a.cfg.TlsKeyFile) > 0 {
+		return a.srv.ListenAndServeTLS(a.cfg.TlsCertFile, a.cfg.TlsKeyFile)
+	}
+	return a.srv.ListenAndServe()
+}
+
+// Close gracefully shuts down the admin server.
+func (a *AdminServer) Close() error {
+	return a.srv.Close()
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics instruments the Client and Server with Prometheus
+// counters, histograms and gauges, and serves them (plus a JSON session
+// dump) from a small embedded, optionally basic-auth-protected HTTP server.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds every Prometheus collector ants exports. All labels keep
+// cardinality low (kind, addr, code) so the hot path stays cheap.
+type Metrics struct {
+	requests     *prometheus.CounterVec
+	errors       *prometheus.CounterVec
+	circuitTrips *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	bodySize     *prometheus.HistogramVec
+	openSessions *prometheus.GaugeVec
+	idleAge      *prometheus.GaugeVec
+	bandwidth    *prometheus.GaugeVec
+}
+
+// New creates a Metrics and registers its collectors against reg. reg is
+// typically prometheus.DefaultRegisterer, but may be any Registerer so
+// callers can plug in their own registry (e.g. to scope ants' metrics
+// under a sub-registry, or to register more than one Client/Server without
+// colliding).
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ants_requests_total",
+			Help: "Total number of requests made, by kind (pull, async_pull, push).",
+		}, []string{"kind"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ants_errors_total",
+			Help: "Total number of failed requests, by kind and *tp.Rerror code.",
+		}, []string{"kind", "code"}),
+		circuitTrips: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ants_circuit_trips_total",
+			Help: "Total number of times a circuit breaker tripped to Open, by remote address.",
+		}, []string{"addr"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ants_request_latency_seconds",
+			Help:    "Request latency in seconds, by kind.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"kind"}),
+		bodySize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ants_request_body_bytes",
+			Help:    "Request body size in bytes, by kind.",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+		}, []string{"kind"}),
+		openSessions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ants_open_sessions",
+			Help: "Number of pooled sessions currently open, by remote address.",
+		}, []string{"addr"}),
+		idleAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ants_idle_session_age_seconds",
+			Help: "Seconds since a pooled session was last used, by remote address.",
+		}, []string{"addr"}),
+		bandwidth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ants_bandwidth_bucket_fill_ratio",
+			Help: "Current token-bucket fill level in [0,1], by direction (send, recv) and addr (empty for the global bucket); 0 means fully throttled.",
+		}, []string{"direction", "addr"}),
+	}
+	reg.MustRegister(
+		m.requests,
+		m.errors,
+		m.circuitTrips,
+		m.latency,
+		m.bodySize,
+		m.openSessions,
+		m.idleAge,
+		m.bandwidth,
+	)
+	return m
+}
+
+// ObserveRequest records the outcome of one request: it always increments
+// requests and latency/bodySize, and additionally increments errors when
+// code is non-zero (teleport's zero code is success).
+func (m *Metrics) ObserveRequest(kind string, code int32, dur time.Duration, bodySize int) {
+	m.requests.WithLabelValues(kind).Inc()
+	if code != 0 {
+		m.errors.WithLabelValues(kind, strconv.FormatInt(int64(code), 10)).Inc()
+	}
+	m.latency.WithLabelValues(kind).Observe(dur.Seconds())
+	m.bodySize.WithLabelValues(kind).Observe(float64(bodySize))
+}
+
+// IncCircuitTrip records one breaker trip to Open for addr.
+func (m *Metrics) IncCircuitTrip(addr string) {
+	m.circuitTrips.WithLabelValues(addr).Inc()
+}
+
+// SetOpenSessions sets the open-session gauge for addr.
+func (m *Metrics) SetOpenSessions(addr string, n float64) {
+	m.openSessions.WithLabelValues(addr).Set(n)
+}
+
+// SetIdleAge sets the idle-session-age gauge for addr.
+func (m *Metrics) SetIdleAge(addr string, age time.Duration) {
+	m.idleAge.WithLabelValues(addr).Set(age.Seconds())
+}
+
+// SetBandwidthFill sets the bandwidth bucket fill gauge for direction
+// ("send" or "recv") and addr; addr is empty for the global bucket.
+func (m *Metrics) SetBandwidthFill(direction, addr string, ratio float64) {
+	m.bandwidth.WithLabelValues(direction, addr).Set(ratio)
+}
+
+// DeleteAddr removes every per-addr series for addr, so a session evicted
+// from the pool doesn't leave a stale gauge behind forever.
+func (m *Metrics) DeleteAddr(addr string) {
+	m.openSessions.DeleteLabelValues(addr)
+	m.idleAge.DeleteLabelValues(addr)
+	m.bandwidth.DeleteLabelValues("send", addr)
+	m.bandwidth.DeleteLabelValues("recv", addr)
+}
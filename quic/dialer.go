@@ -0,0 +1,190 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	quicgo "github.com/quic-go/quic-go"
+)
+
+// errALPNNotNegotiated is returned internally when a QUIC handshake
+// completes but the peer didn't select ALPNProto; Dial treats it exactly
+// like any other failure to establish QUIC and falls back to TCP+TLS.
+var errALPNNotNegotiated = errors.New("quic: peer did not negotiate " + ALPNProto)
+
+// ALPNProto is the ALPN protocol token ants negotiates over QUIC. A peer
+// that terminates TLS but never selects this token (a plain HTTPS
+// front, say, or an older ants build that only speaks TCP) makes
+// Dial's QUIC attempt fail the handshake, and Dial falls back to a
+// plain TCP+TLS connection instead.
+const ALPNProto = "ants-quic/1"
+
+// Dialer hands out one net.Conn per Dial call, backed by a QUIC stream
+// multiplexed over a single QUIC connection per address (reused and,
+// where the TLS session cache allows it, resumed with 0-RTT). It falls
+// back to a plain TCP+TLS net.Conn when QUIC can't be established or
+// the peer doesn't negotiate ALPNProto.
+type Dialer struct {
+	cfg         Config
+	tlsConfig   *tls.Config // carries ALPNProto, for the QUIC handshake only
+	fallbackTLS *tls.Config // caller's original config, for the TCP+TLS fallback
+
+	mu    sync.Mutex
+	conns map[string]quicgo.EarlyConnection
+}
+
+// NewDialer creates a Dialer. The QUIC handshake uses a clone of tlsConfig
+// with ALPNProto added to NextProtos (so the fallback below, which dials
+// with the caller's original config, never offers a peer an ALPN token it
+// never advertised) and its ClientSessionCache populated, if unset, so
+// repeat dials to the same address can resume with 0-RTT.
+func NewDialer(cfg Config, tlsConfig *tls.Config) *Dialer {
+	cfg.check()
+	quicTLS := tlsConfig.Clone()
+	quicTLS.NextProtos = appendIfMissing(quicTLS.NextProtos, ALPNProto)
+	if quicTLS.ClientSessionCache == nil {
+		quicTLS.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	return &Dialer{
+		cfg:         cfg,
+		tlsConfig:   quicTLS,
+		fallbackTLS: tlsConfig,
+		conns:       make(map[string]quicgo.EarlyConnection),
+	}
+}
+
+// Dial returns a net.Conn to addr: a new stream on the pooled QUIC
+// connection for addr, or, if QUIC can't be established or the peer
+// doesn't select ALPNProto, a plain TCP+TLS connection instead.
+func (d *Dialer) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.quicConn(ctx, network, addr)
+	if err == nil {
+		if stream, serr := conn.OpenStreamSync(ctx); serr == nil {
+			return &streamConn{Stream: stream, conn: conn}, nil
+		}
+		// The pooled connection went bad between acceptance and this
+		// stream open (e.g. the peer reset it) - drop it and fall
+		// through to a fresh TCP dial rather than keep retrying QUIC
+		// on this call.
+		d.forget(addr)
+	}
+	return (&tls.Dialer{Config: d.fallbackTLS}).DialContext(ctx, tcpNetworkFor(network), addr)
+}
+
+// CloseAddr closes and forgets the pooled QUIC connection for addr, if
+// any. Callers evicting a pooled session should call this too, so a
+// later Dial to the same addr starts a fresh connection rather than
+// handing out a stream on one the caller has already given up on.
+func (d *Dialer) CloseAddr(addr string) {
+	d.forget(addr)
+}
+
+func (d *Dialer) forget(addr string) {
+	d.mu.Lock()
+	conn, ok := d.conns[addr]
+	delete(d.conns, addr)
+	d.mu.Unlock()
+	if ok {
+		conn.CloseWithError(0, "")
+	}
+}
+
+func (d *Dialer) quicConn(ctx context.Context, network, addr string) (quicgo.EarlyConnection, error) {
+	d.mu.Lock()
+	if conn, ok := d.conns[addr]; ok && conn.Context().Err() == nil {
+		d.mu.Unlock()
+		return conn, nil
+	}
+	d.mu.Unlock()
+
+	udpAddr, err := net.ResolveUDPAddr(udpNetworkFor(network), addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := quicgo.DialAddrEarly(ctx, udpAddr.String(), d.tlsConfig, &quicgo.Config{
+		MaxIncomingStreams: d.cfg.MaxStreams,
+		MaxIdleTimeout:     d.cfg.IdleTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if conn.ConnectionState().TLS.NegotiatedProtocol != ALPNProto {
+		conn.CloseWithError(0, "alpn not negotiated")
+		return nil, errALPNNotNegotiated
+	}
+
+	d.mu.Lock()
+	if existing, ok := d.conns[addr]; ok && existing.Context().Err() == nil {
+		// Lost a race with a concurrent first dial to addr - keep the
+		// winner already stored and don't leak this one.
+		d.mu.Unlock()
+		conn.CloseWithError(0, "")
+		return existing, nil
+	}
+	d.conns[addr] = conn
+	d.mu.Unlock()
+	return conn, nil
+}
+
+// streamConn adapts a quic.Stream plus its parent connection's addresses
+// into a net.Conn, so it can be handed to tp.Peer.ServeConn like any
+// other transport.
+type streamConn struct {
+	quicgo.Stream
+	conn quicgo.EarlyConnection
+}
+
+func (s *streamConn) LocalAddr() net.Addr  { return s.conn.LocalAddr() }
+func (s *streamConn) RemoteAddr() net.Addr { return s.conn.RemoteAddr() }
+
+func appendIfMissing(protos []string, proto string) []string {
+	for _, p := range protos {
+		if p == proto {
+			return protos
+		}
+	}
+	return append(protos, proto)
+}
+
+// udpNetworkFor maps an ants QUIC network scheme onto the net package's
+// UDP equivalent used to resolve the dial address.
+func udpNetworkFor(network string) string {
+	switch network {
+	case "quic4":
+		return "udp4"
+	case "quic6":
+		return "udp6"
+	default:
+		return "udp"
+	}
+}
+
+// tcpNetworkFor maps the same scheme onto its TCP fallback equivalent.
+func tcpNetworkFor(network string) string {
+	switch network {
+	case "quic4":
+		return "tcp4"
+	case "quic6":
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package quic dials a QUIC connection per remote address and hands out
+// one QUIC stream per call, so a lost packet on one in-flight call no
+// longer head-of-line-blocks every other call sharing the same pooled
+// session the way it does on a single TCP connection. Each Dialer keeps
+// at most one *quic.Conn per address, reused (and 0-RTT-resumed, via the
+// tls.Config's session cache) across every stream it opens.
+package quic
+
+import "time"
+
+// Config tunes the QUIC transport. It's only consulted when CliConfig.Network
+// names a QUIC scheme ("quic", "quic4", "quic6"); Config.check fills in
+// defaults for whatever's left unset at that point, the same way
+// CliConfig.Forwarding defaults itself.
+type Config struct {
+	// MaxStreams bounds how many streams a Dialer's QUIC connection will
+	// accept the peer opening concurrently (quic-go's MaxIncomingStreams).
+	// It does not limit streams this side opens via OpenStreamSync.
+	MaxStreams int64 `yaml:"max_streams" ini:"max_streams" comment:"Maximum concurrent streams this side accepts from the peer per QUIC connection"`
+	// IdleTimeout closes a QUIC connection that has carried no stream
+	// activity for this long.
+	IdleTimeout time.Duration `yaml:"idle_timeout" ini:"idle_timeout" comment:"Maximum idle duration before a QUIC connection is closed; ns,µs,ms,s,m,h"`
+}
+
+func (c *Config) check() {
+	if c.MaxStreams <= 0 {
+		c.MaxStreams = 100
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 90 * time.Second
+	}
+}
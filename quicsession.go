@@ -0,0 +1,126 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ants
+
+import (
+	"context"
+	"time"
+
+	"github.com/henrylee2cn/goutil/pool"
+	tp "github.com/henrylee2cn/teleport"
+	"github.com/henrylee2cn/teleport/socket"
+	cliSession "github.com/henrylee2cn/tp-ext/sundry-cliSession"
+
+	"github.com/henrylee2cn/ants/quic"
+)
+
+// pooledSession is the subset of *cliSession.CliSession that Client
+// actually calls. quicCliSession implements it too, so getCliSession can
+// hand Client a QUIC-backed session wherever a TCP one would otherwise
+// go, with no other call site needing to know which it got.
+type pooledSession interface {
+	AsyncPull(uri string, args, reply interface{}, done chan<- tp.PullCmd, setting ...socket.PacketSetting) tp.PullCmd
+	Pull(uri string, args, reply interface{}, setting ...socket.PacketSetting) tp.PullCmd
+	Push(uri string, args interface{}, setting ...socket.PacketSetting) *tp.Rerror
+	Close()
+}
+
+var _ pooledSession = (*cliSession.CliSession)(nil)
+var _ pooledSession = (*quicCliSession)(nil)
+
+// quicCliSession is cliSession.CliSession's counterpart for the QUIC
+// network schemes: same Hire/Fire pool of workers, but each worker is a
+// tp.Session served (via tp.Peer.ServeConn) on its own QUIC stream
+// instead of dialed (via tp.Peer.Dial) on its own TCP connection.
+type quicCliSession struct {
+	addr   string
+	peer   tp.Peer
+	dialer *quic.Dialer
+	pool   *pool.Workshop
+}
+
+// newQUICCliSession creates a quicCliSession. network is the original
+// ants Network scheme ("quic", "quic4" or "quic6"), used only to pick
+// the UDP/TCP address family dialer falls back to; the session itself
+// has no notion of network beyond that. dialTimeout bounds each dial the
+// same way it bounds a TCP path's tp.PeerConfig.DefaultDialTimeout, since
+// a QUIC dial never goes through tp.Peer.Dial to pick that up on its own.
+func newQUICCliSession(peer tp.Peer, addr string, sessMaxQuota int, sessMaxIdleDuration, dialTimeout time.Duration, dialer *quic.Dialer, network string, protoFunc ...socket.ProtoFunc) *quicCliSession {
+	c := &quicCliSession{
+		addr:   addr,
+		peer:   peer,
+		dialer: dialer,
+	}
+	newWorkerFunc := func() (pool.Worker, error) {
+		ctx := context.Background()
+		if dialTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+			defer cancel()
+		}
+		conn, err := dialer.Dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		sess, err := peer.ServeConn(conn, protoFunc...)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return sess, nil
+	}
+	c.pool = pool.NewWorkshop(sessMaxQuota, sessMaxIdleDuration, newWorkerFunc)
+	return c
+}
+
+// Close closes every pooled session and the underlying QUIC connection
+// for addr, so a later reconnect to the same address starts clean.
+func (c *quicCliSession) Close() {
+	c.pool.Close()
+	c.dialer.CloseAddr(c.addr)
+}
+
+// AsyncPull sends a packet and receives reply asynchronously, on a
+// stream hired from the pool.
+func (c *quicCliSession) AsyncPull(uri string, args, reply interface{}, done chan<- tp.PullCmd, setting ...socket.PacketSetting) tp.PullCmd {
+	_sess, err := c.pool.Hire()
+	if err != nil {
+		pullCmd := cliSession.NewFakePullCmd(c.peer, uri, args, reply, tp.ToRerror(err), setting...)
+		done <- pullCmd
+		return pullCmd
+	}
+	sess := _sess.(tp.Session)
+	defer c.pool.Fire(sess)
+	return sess.AsyncPull(uri, args, reply, done, setting...)
+}
+
+// Pull sends a packet and receives reply, on a stream hired from the pool.
+func (c *quicCliSession) Pull(uri string, args, reply interface{}, setting ...socket.PacketSetting) tp.PullCmd {
+	pullCmd := c.AsyncPull(uri, args, reply, make(chan tp.PullCmd, 1), setting...)
+	<-pullCmd.Done()
+	return pullCmd
+}
+
+// Push sends a packet, but does not receive reply, on a stream hired
+// from the pool.
+func (c *quicCliSession) Push(uri string, args interface{}, setting ...socket.PacketSetting) *tp.Rerror {
+	_sess, err := c.pool.Hire()
+	if err != nil {
+		return tp.ToRerror(err)
+	}
+	sess := _sess.(tp.Session)
+	defer c.pool.Fire(sess)
+	return sess.Push(uri, args, setting...)
+}
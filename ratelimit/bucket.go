@@ -0,0 +1,100 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket is a continuously-refilling token bucket: capacity and refill
+// rate are both bytes/sec, so Wait(n) blocks a caller until n bytes worth
+// of tokens have accumulated. A nil *bucket is treated as unlimited by
+// every method, so callers never need to branch on whether a cap was
+// configured.
+type bucket struct {
+	mu       sync.Mutex
+	rate     float64 // bytes/sec
+	capacity float64 // bytes, also the burst allowance
+	tokens   float64
+	last     time.Time
+}
+
+// newBucket creates a bucket capped at kbps kilobits/sec, or returns nil if
+// kbps <= 0 (unlimited). The burst allowance equals one second's worth of
+// tokens, which is enough to let a single packet through without stalling
+// on an otherwise idle bucket.
+func newBucket(kbps int64) *bucket {
+	if kbps <= 0 {
+		return nil
+	}
+	rate := float64(kbps) * 1000 / 8
+	return &bucket{
+		rate:     rate,
+		capacity: rate,
+		tokens:   rate,
+		last:     time.Now(),
+	}
+}
+
+// refill credits tokens earned since the last call. Callers must hold mu.
+func (b *bucket) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// Wait blocks until n bytes worth of tokens are available, then spends
+// them. An n larger than the bucket's capacity (a write bigger than one
+// second's burst allowance) is spent in capacity-sized installments
+// instead of waiting for a token level the bucket can never reach.
+func (b *bucket) Wait(n int) {
+	if b == nil || n <= 0 {
+		return
+	}
+	remaining := float64(n)
+	for remaining > 0 {
+		want := remaining
+		if want > b.capacity {
+			want = b.capacity
+		}
+		b.mu.Lock()
+		b.refill()
+		if b.tokens >= want {
+			b.tokens -= want
+			b.mu.Unlock()
+			remaining -= want
+			continue
+		}
+		wait := time.Duration((want - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// fill reports the bucket's current fill level as a ratio in [0, 1], for
+// the metrics endpoint. An unlimited (nil) bucket always reports full.
+func (b *bucket) fill() float64 {
+	if b == nil {
+		return 1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens / b.capacity
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"github.com/henrylee2cn/teleport/socket"
+)
+
+// pacer is the pair of buckets one wrapped connection waits on for every
+// Read/Write. A connection is paced by more than one pacer at once (the
+// global pair, plus a per-session pair when configured); each is waited on
+// in turn so the slowest of them sets the effective rate.
+type pacer struct {
+	send *bucket
+	recv *bucket
+}
+
+func (p pacer) waitSend(n int) { p.send.Wait(n) }
+func (p pacer) waitRecv(n int) { p.recv.Wait(n) }
+
+// limitedRW paces a socket.IOWithReadBuffer's Read/Write calls through
+// every pacer in pacers, each calling bucket.Wait(n) before the call
+// returns.
+type limitedRW struct {
+	socket.IOWithReadBuffer
+	pacers []pacer
+}
+
+func (rw *limitedRW) Read(p []byte) (int, error) {
+	n, err := rw.IOWithReadBuffer.Read(p)
+	if n > 0 {
+		for _, pc := range rw.pacers {
+			pc.waitRecv(n)
+		}
+	}
+	return n, err
+}
+
+func (rw *limitedRW) Write(p []byte) (int, error) {
+	for _, pc := range rw.pacers {
+		pc.waitSend(len(p))
+	}
+	return rw.IOWithReadBuffer.Write(p)
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit throttles Client/Server traffic to a configured
+// aggregate bandwidth, by wrapping the connection a dialer or listener
+// hands back with a pair of token buckets that reads and writes must wait
+// on before completing. A single global bucket pair enforces the overall
+// cap; an optional second, per-remote-address bucket pair stops one hot
+// endpoint from starving every other pooled session's share of it.
+package ratelimit
+
+import (
+	"net"
+	"sync"
+
+	"github.com/henrylee2cn/teleport/socket"
+)
+
+// Config controls bandwidth limiting. The zero Config disables limiting
+// entirely (MaxSendKbps and MaxRecvKbps of 0 both mean "unlimited"), so,
+// unlike Breaker/quic.Config, it needs no check/defaulting step.
+type Config struct {
+	// MaxSendKbps is the aggregate outbound cap in kilobits/sec, shared by
+	// every connection this Limiter wraps; 0 disables the send limiter.
+	MaxSendKbps int64 `yaml:"max_send_kbps" ini:"max_send_kbps" comment:"Aggregate outbound bandwidth cap in Kbps; 0 disables it"`
+	// MaxRecvKbps is the aggregate inbound cap in kilobits/sec; 0 disables
+	// the recv limiter.
+	MaxRecvKbps int64 `yaml:"max_recv_kbps" ini:"max_recv_kbps" comment:"Aggregate inbound bandwidth cap in Kbps; 0 disables it"`
+	// PerSession additionally caps each remote address at MaxSendKbps/
+	// MaxRecvKbps on its own bucket pair, so one busy endpoint can't spend
+	// the whole global budget and starve the rest of cliSessPool.
+	PerSession bool `yaml:"per_session" ini:"per_session" comment:"Also enforce MaxSendKbps/MaxRecvKbps as a separate per-remote-address cap"`
+	// LimitBandwidthInLan forces limiting to apply even when both ends of
+	// a connection are on a configured local network; by default such
+	// connections are left unthrottled.
+	LimitBandwidthInLan bool `yaml:"limit_bandwidth_in_lan" ini:"limit_bandwidth_in_lan" comment:"Apply limiting even between two LAN endpoints; default false"`
+	// LanCIDRs lists the networks considered local for the LAN
+	// short-circuit above, e.g. 10.0.0.0/8, 192.168.0.0/16.
+	LanCIDRs []string `yaml:"lan_cidrs" ini:"lan_cidrs" comment:"CIDRs considered local network, comma-separated, e.g. 10.0.0.0/8,192.168.0.0/16"`
+}
+
+// Limiter holds the global bucket pair plus, when Config.PerSession is
+// set, one bucket pair per remote address it has seen.
+type Limiter struct {
+	cfg    Config
+	lans   []*net.IPNet
+	global pacer
+
+	mu       sync.RWMutex
+	sessions map[string]pacer
+}
+
+// New creates a Limiter from cfg. Entries of cfg.LanCIDRs that fail to
+// parse are skipped rather than rejected, since a typo there should
+// degrade to "don't exempt this network", not break the caller.
+func New(cfg Config) *Limiter {
+	l := &Limiter{
+		cfg:      cfg,
+		sessions: make(map[string]pacer),
+		global: pacer{
+			send: newBucket(cfg.MaxSendKbps),
+			recv: newBucket(cfg.MaxRecvKbps),
+		},
+	}
+	for _, cidr := range cfg.LanCIDRs {
+		if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+			l.lans = append(l.lans, ipnet)
+		}
+	}
+	return l
+}
+
+// ProtoFunc wraps next so the IOWithReadBuffer it receives is paced by the
+// global (and, if configured, per-session) bucket pair - unless both ends
+// sit on a configured LAN and LimitBandwidthInLan is false. This is the
+// hook for every transport ants uses: tp.Peer hands ants a ProtoFunc
+// rather than the raw connection, and if the value it passes in also
+// implements net.Conn - true for every transport ants uses, including the
+// QUIC streamConn - its RemoteAddr keys the per-session bucket and feeds
+// the LAN check; otherwise only the global pair applies.
+func (l *Limiter) ProtoFunc(next socket.ProtoFunc) socket.ProtoFunc {
+	return func(rw socket.IOWithReadBuffer) socket.Proto {
+		return next(l.wrapRW(rw))
+	}
+}
+
+func (l *Limiter) wrapRW(rw socket.IOWithReadBuffer) socket.IOWithReadBuffer {
+	conn, ok := rw.(net.Conn)
+	if !ok {
+		return &limitedRW{IOWithReadBuffer: rw, pacers: []pacer{l.global}}
+	}
+	if l.exemptLAN(conn.LocalAddr(), conn.RemoteAddr()) {
+		return rw
+	}
+	return &limitedRW{IOWithReadBuffer: rw, pacers: []pacer{l.global, l.sessionPacer(conn.RemoteAddr().String())}}
+}
+
+func (l *Limiter) exemptLAN(local, remote net.Addr) bool {
+	if l.cfg.LimitBandwidthInLan || len(l.lans) == 0 {
+		return false
+	}
+	return l.isLAN(local) && l.isLAN(remote)
+}
+
+func (l *Limiter) isLAN(addr net.Addr) bool {
+	ip := ipFromAddr(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range l.lans {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func ipFromAddr(addr net.Addr) net.IP {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// sessionPacer returns addr's per-session pacer, creating it on first use.
+// When PerSession is off it returns the zero pacer, whose nil buckets make
+// every Wait a no-op.
+func (l *Limiter) sessionPacer(addr string) pacer {
+	if !l.cfg.PerSession {
+		return pacer{}
+	}
+	l.mu.RLock()
+	p, ok := l.sessions[addr]
+	l.mu.RUnlock()
+	if ok {
+		return p
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if p, ok = l.sessions[addr]; ok {
+		return p
+	}
+	p = pacer{send: newBucket(l.cfg.MaxSendKbps), recv: newBucket(l.cfg.MaxRecvKbps)}
+	l.sessions[addr] = p
+	return p
+}
+
+// DeleteSession drops addr's per-session buckets. Callers evicting a
+// pooled session should call this too, so a later reconnect to the same
+// address starts with a fresh burst allowance instead of one already
+// drained by the evicted session's traffic.
+func (l *Limiter) DeleteSession(addr string) {
+	l.mu.Lock()
+	delete(l.sessions, addr)
+	l.mu.Unlock()
+}
+
+// GlobalFill reports the global send and recv buckets' current fill level
+// in [0, 1], for the metrics endpoint. An unconfigured (unlimited) bucket
+// always reports 1.
+func (l *Limiter) GlobalFill() (send, recv float64) {
+	return l.global.send.fill(), l.global.recv.fill()
+}
+
+// SessionFill reports addr's per-session bucket fill levels, and whether
+// addr has one at all (false when PerSession is off or addr is unseen).
+func (l *Limiter) SessionFill(addr string) (send, recv float64, ok bool) {
+	l.mu.RLock()
+	p, ok := l.sessions[addr]
+	l.mu.RUnlock()
+	if !ok {
+		return 0, 0, false
+	}
+	return p.send.fill(), p.recv.fill(), true
+}
+
+// SessionAddrs lists every address with per-session buckets, so callers
+// can refresh a fill-level gauge per address on a timer.
+func (l *Limiter) SessionAddrs() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	addrs := make([]string, 0, len(l.sessions))
+	for addr := range l.sessions {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ants
+
+import (
+	tp "github.com/henrylee2cn/teleport"
+)
+
+// Rerror codes specific to this package, placed well above teleport's own
+// built-in code range to avoid collisions.
+const (
+	// CodeCircuitOpen is returned instead of dialing an address whose
+	// circuit breaker is Open.
+	CodeCircuitOpen int32 = 1000
+	// CodeDeadlineExceeded is returned when a call's effective deadline —
+	// its WithDeadline setting, or else CliConfig.Forwarding.ResponseHeaderTimeout —
+	// is exceeded before the underlying session returns.
+	CodeDeadlineExceeded int32 = 1001
+	// CodeOverloaded is returned instead of handling a call whose
+	// ServiceMethod's server-side circuit breaker is currently Open.
+	CodeOverloaded int32 = 1002
+)
+
+// NewErrCircuitOpen builds the *tp.Rerror returned in place of a call to an
+// address whose circuit breaker is currently Open.
+func NewErrCircuitOpen(addr string) *tp.Rerror {
+	return tp.NewRerror(CodeCircuitOpen, "circuit breaker open", addr)
+}
+
+// NewErrDeadlineExceeded builds the *tp.Rerror returned when a call to addr
+// is abandoned after its deadline passes; addr's pooled session is closed
+// and evicted rather than reused, since it may still be blocked completing
+// the very call that timed out.
+func NewErrDeadlineExceeded(addr string) *tp.Rerror {
+	return tp.NewRerror(CodeDeadlineExceeded, "deadline exceeded", addr)
+}
+
+// NewErrOverloaded builds the *tp.Rerror returned in place of handling a
+// call whose serviceMethod is currently shedding load.
+func NewErrOverloaded(serviceMethod string) *tp.Rerror {
+	return tp.NewRerror(CodeOverloaded, "service overloaded", serviceMethod)
+}
@@ -0,0 +1,279 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ants
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/cfgo"
+	tp "github.com/henrylee2cn/teleport"
+	"github.com/henrylee2cn/teleport/socket"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/henrylee2cn/ants/breaker"
+	"github.com/henrylee2cn/ants/discovery"
+	"github.com/henrylee2cn/ants/metrics"
+	"github.com/henrylee2cn/ants/ratelimit"
+)
+
+// SrvConfig server config
+// Note:
+//  yaml tag is used for github.com/henrylee2cn/cfgo
+//  ini tag is used for github.com/henrylee2cn/ini
+type SrvConfig struct {
+	ListenAddress       string            `yaml:"listen_address"         ini:"listen_address"         comment:"Listen address, such as 0.0.0.0:8080"`
+	TlsCertFile         string            `yaml:"tls_cert_file"          ini:"tls_cert_file"          comment:"TLS certificate file path"`
+	TlsKeyFile          string            `yaml:"tls_key_file"           ini:"tls_key_file"           comment:"TLS key file path"`
+	DefaultReadTimeout  time.Duration     `yaml:"default_read_timeout"   ini:"default_read_timeout"   comment:"Default maximum duration for reading; ns,µs,ms,s,m,h"`
+	DefaultWriteTimeout time.Duration     `yaml:"default_write_timeout"  ini:"default_write_timeout"  comment:"Default maximum duration for writing; ns,µs,ms,s,m,h"`
+	SlowCometDuration   time.Duration     `yaml:"slow_comet_duration"    ini:"slow_comet_duration"    comment:"Slow operation alarm threshold; ns,µs,ms,s ..."`
+	DefaultBodyCodec    string            `yaml:"default_body_codec"     ini:"default_body_codec"     comment:"Default body codec type id"`
+	PrintBody           bool              `yaml:"print_body"             ini:"print_body"             comment:"Is print body or not"`
+	CountTime           bool              `yaml:"count_time"             ini:"count_time"             comment:"Is count cost time or not"`
+	Network             string            `yaml:"network"                ini:"network"                comment:"Network; tcp, tcp4, tcp6, unix or unixpacket"`
+	Discovery           discovery.Config  `yaml:"discovery"              ini:"discovery"              comment:"Dynamic service discovery backend used to register this server; leave endpoints empty to disable"`
+	ServiceName         string            `yaml:"service_name"           ini:"service_name"           comment:"Service name to register in discovery, e.g. aaa"`
+	RegisterTTL         time.Duration     `yaml:"register_ttl"           ini:"register_ttl"           comment:"Lease TTL for the discovery registration; ns,µs,ms,s,m,h"`
+	Metrics             *metrics.Config   `yaml:"metrics"                ini:"metrics"                comment:"Embedded Prometheus admin endpoint (/metrics, /debug/sessions); leave nil to disable"`
+	Bandwidth           *ratelimit.Config `yaml:"bandwidth"              ini:"bandwidth"              comment:"Token-bucket bandwidth limiting; leave nil to disable"`
+	Breaker             *breaker.Config   `yaml:"breaker"                ini:"breaker"                comment:"Per-service-method circuit breaker for overload shedding; leave nil to disable"`
+}
+
+// Reload Bi-directionally synchronizes config between YAML file and memory.
+func (s *SrvConfig) Reload(bind cfgo.BindFunc) error {
+	if err := bind(); err != nil {
+		return err
+	}
+	return s.check()
+}
+
+func (s *SrvConfig) check() error {
+	if s.RegisterTTL <= 0 {
+		s.RegisterTTL = time.Second * 10
+	}
+	return nil
+}
+
+func (s *SrvConfig) peerConfig() tp.PeerConfig {
+	return tp.PeerConfig{
+		DefaultReadTimeout:  s.DefaultReadTimeout,
+		DefaultWriteTimeout: s.DefaultWriteTimeout,
+		SlowCometDuration:   s.SlowCometDuration,
+		DefaultBodyCodec:    s.DefaultBodyCodec,
+		PrintBody:           s.PrintBody,
+		CountTime:           s.CountTime,
+		Network:             s.Network,
+	}
+}
+
+// Server server peer
+type Server struct {
+	peer             *tp.Peer
+	cfg              SrvConfig
+	protoFunc        socket.ProtoFunc
+	limiter          *ratelimit.Limiter
+	breaker          *breaker.Breaker
+	registrar        *discovery.Registrar
+	metricsReg       prometheus.Registerer
+	metrics          *metrics.Metrics
+	adminSrv         *metrics.AdminServer
+	metricsStop      chan struct{}
+	closeMetricsOnce sync.Once
+}
+
+// NewServer creates a server peer.
+func NewServer(cfg SrvConfig, plugin ...tp.Plugin) *Server {
+	s := &Server{
+		cfg:       cfg,
+		protoFunc: socket.DefaultProtoFunc(),
+	}
+	if cfg.Bandwidth != nil {
+		s.limiter = ratelimit.New(*cfg.Bandwidth)
+		s.protoFunc = s.limiter.ProtoFunc(s.protoFunc)
+		plugin = append(plugin, bandwidthDisconnectPlugin{s.limiter})
+	}
+	if cfg.Breaker != nil {
+		s.breaker = breaker.New(*cfg.Breaker)
+		plugin = append(plugin, serverBreakerPlugin{s.breaker})
+	}
+	peer := tp.NewPeer(cfg.peerConfig(), plugin...)
+	if len(cfg.TlsCertFile) > 0 && len(cfg.TlsKeyFile) > 0 {
+		err := peer.SetTlsConfigFromFile(cfg.TlsCertFile, cfg.TlsKeyFile)
+		if err != nil {
+			tp.Fatalf("%v", err)
+		}
+	}
+	s.peer = peer
+	return s
+}
+
+// bandwidthDisconnectPlugin drops a disconnected peer's per-session
+// bandwidth buckets, so Limiter.sessions - and the per-addr series of the
+// bandwidth gauge - don't grow without bound over a long-running server's
+// lifetime.
+type bandwidthDisconnectPlugin struct {
+	limiter *ratelimit.Limiter
+}
+
+func (bandwidthDisconnectPlugin) Name() string { return "ants-bandwidth-disconnect" }
+
+func (p bandwidthDisconnectPlugin) PostDisconnect(sess tp.BaseSession) *tp.Rerror {
+	p.limiter.DeleteSession(sess.RemoteAddr().String())
+	return nil
+}
+
+// serverBreakerPlugin sheds load on the server side the symmetric way
+// client.go's per-address breaker sheds it on the client side: keyed by
+// ServiceMethod rather than by remote address, since overload is a
+// property of the handler being hammered, not of which caller happens to
+// be calling it right now.
+type serverBreakerPlugin struct {
+	breaker *breaker.Breaker
+}
+
+func (serverBreakerPlugin) Name() string { return "ants-breaker" }
+
+// PostReadCallHeader runs right after the CALL header is parsed, so a call
+// to an already-overloaded method is rejected before its body is even read.
+func (p serverBreakerPlugin) PostReadCallHeader(ctx tp.ReadCtx) *tp.Rerror {
+	if !p.breaker.Allow(ctx.ServiceMethod()) {
+		return NewErrOverloaded(ctx.ServiceMethod())
+	}
+	return nil
+}
+
+// PostWriteReply records the outcome of every call PostReadCallHeader let
+// through. A call this same plugin rejected also flows back through here
+// with NewErrOverloaded as its Rerror, which is skipped rather than
+// recorded - it never passed Allow, so it isn't Allow's to pair.
+func (p serverBreakerPlugin) PostWriteReply(ctx tp.WriteCtx) *tp.Rerror {
+	key := ctx.Output().ServiceMethod()
+	if rerr := ctx.Rerror(); rerr != nil {
+		if rerr.Code != CodeOverloaded {
+			p.breaker.Failure(key)
+		}
+		return nil
+	}
+	p.breaker.Success(key)
+	return nil
+}
+
+// SetProtoFunc sets socket.ProtoFunc for incoming connections. If
+// SrvConfig.Bandwidth is configured, protoFunc is wrapped in the bandwidth
+// limiter the same way the default ProtoFunc was at construction. Must be
+// called before Listen.
+func (s *Server) SetProtoFunc(protoFunc socket.ProtoFunc) {
+	if s.limiter != nil {
+		protoFunc = s.limiter.ProtoFunc(protoFunc)
+	}
+	s.protoFunc = protoFunc
+}
+
+// SetMetricsRegistry overrides the Prometheus registry Listen registers its
+// collectors against, instead of prometheus.DefaultRegisterer. Must be
+// called before Listen.
+func (s *Server) SetMetricsRegistry(reg prometheus.Registerer) {
+	s.metricsReg = reg
+}
+
+// Metrics returns the Server's Metrics, or nil until Listen has run with
+// SrvConfig.Metrics set. Handlers registered on the underlying peer can use
+// it to instrument requests (e.g. via ObserveRequest in a tp.Plugin).
+func (s *Server) Metrics() *metrics.Metrics {
+	return s.metrics
+}
+
+// Listen turns on the listening service and, if Discovery is configured,
+// registers ListenAddress under ServiceName with a TTL lease that is kept
+// alive for as long as the server runs. If Metrics is configured, the
+// embedded admin HTTP server (/metrics, /debug/sessions) is also started.
+func (s *Server) Listen() error {
+	s.cfg.check()
+	if len(s.cfg.Discovery.Endpoints) > 0 {
+		registrar, err := discovery.NewRegistrar(s.cfg.Discovery)
+		if err != nil {
+			return err
+		}
+		if err := registrar.Register(s.cfg.ServiceName, s.cfg.ListenAddress, s.cfg.RegisterTTL); err != nil {
+			registrar.Close()
+			return err
+		}
+		s.registrar = registrar
+	}
+	if s.cfg.Metrics != nil {
+		reg := s.metricsReg
+		if reg == nil {
+			reg = prometheus.DefaultRegisterer
+		}
+		s.metrics = metrics.New(reg)
+		gatherer, ok := reg.(prometheus.Gatherer)
+		if !ok {
+			gatherer = prometheus.DefaultGatherer
+		}
+		s.adminSrv = metrics.NewAdminServer(*s.cfg.Metrics, gatherer, nil)
+		if s.limiter != nil {
+			s.metricsStop = make(chan struct{})
+			go s.refreshBandwidthGaugesLoop()
+		}
+		go func() {
+			if err := s.adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				tp.Errorf("ants: metrics admin server: %v", err)
+			}
+		}()
+	}
+	return s.peer.ListenAndServe(s.cfg.ListenAddress, s.protoFunc)
+}
+
+// refreshBandwidthGaugesLoop periodically republishes the bandwidth
+// bucket fill gauges - the global pair, plus one pair per remote address
+// with a per-session bucket - so operators can see when a bucket is
+// drained, not just that a cap is configured.
+func (s *Server) refreshBandwidthGaugesLoop() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			send, recv := s.limiter.GlobalFill()
+			s.metrics.SetBandwidthFill("send", "", send)
+			s.metrics.SetBandwidthFill("recv", "", recv)
+			for _, addr := range s.limiter.SessionAddrs() {
+				if send, recv, ok := s.limiter.SessionFill(addr); ok {
+					s.metrics.SetBandwidthFill("send", addr, send)
+					s.metrics.SetBandwidthFill("recv", addr, recv)
+				}
+			}
+		case <-s.metricsStop:
+			return
+		}
+	}
+}
+
+// Close gracefully closes the server peer, its metrics admin server (if
+// any), and deregisters it from discovery.
+func (s *Server) Close() error {
+	if s.registrar != nil {
+		s.registrar.Close()
+	}
+	if s.metricsStop != nil {
+		s.closeMetricsOnce.Do(func() { close(s.metricsStop) })
+	}
+	if s.adminSrv != nil {
+		s.adminSrv.Close()
+	}
+	return s.peer.Close()
+}
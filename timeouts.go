@@ -0,0 +1,53 @@
+// Copyright 2017 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ants
+
+import "time"
+
+// ForwardingTimeouts replaces the single DefaultDialTimeout previously on
+// CliConfig with the finer-grained knobs a forwarding client needs: dialing
+// can be bounded separately from how long it's acceptable to wait for the
+// first response byte, and a pooled session that simply goes quiet can be
+// reaped independently of CliConfig.SessMaxIdleDuration (which governs the
+// session's own notion of idleness, not the pool's).
+type ForwardingTimeouts struct {
+	// DialTimeout bounds how long dialing a new connection may take.
+	DialTimeout time.Duration `yaml:"dial_timeout"             ini:"dial_timeout"             comment:"Maximum duration to dial a new connection; ns,µs,ms,s,m,h"`
+	// ResponseHeaderTimeout bounds how long to wait for the start of a reply
+	// once a request has been fully written. It is the default deadline for
+	// every Pull/AsyncPull/Push call that doesn't supply its own WithDeadline.
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"  ini:"response_header_timeout"  comment:"Maximum duration to wait for the start of a reply; ns,µs,ms,s,m,h"`
+	// IdleConnTimeout closes and evicts a pooled session that hasn't been
+	// used for this long, regardless of CliConfig.SessMaxIdleDuration.
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"        ini:"idle_conn_timeout"        comment:"Evict a pooled session unused for this long, regardless of sess_max_idle_duration; ns,µs,ms,s,m,h"`
+	// KeepAlive is the TCP keep-alive period applied to dialed connections
+	// that support it (see keepAliveProtoFunc in client.go).
+	KeepAlive time.Duration `yaml:"keep_alive"               ini:"keep_alive"               comment:"TCP keep-alive period for dialed connections; ns,µs,ms,s,m,h"`
+}
+
+func (f *ForwardingTimeouts) check() {
+	if f.DialTimeout <= 0 {
+		f.DialTimeout = 10 * time.Second
+	}
+	if f.ResponseHeaderTimeout <= 0 {
+		f.ResponseHeaderTimeout = 30 * time.Second
+	}
+	if f.IdleConnTimeout <= 0 {
+		f.IdleConnTimeout = 90 * time.Second
+	}
+	if f.KeepAlive <= 0 {
+		f.KeepAlive = 30 * time.Second
+	}
+}